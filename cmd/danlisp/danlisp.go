@@ -2,13 +2,18 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+
 	"github.com/danwhitford/danlisp/internal/interpreter"
 	"github.com/danwhitford/danlisp/internal/lexer"
 	"github.com/danwhitford/danlisp/internal/parser"
-	"os"
-	"strings"
+	"github.com/danwhitford/danlisp/internal/printer"
+	"github.com/danwhitford/danlisp/internal/token"
 )
 
 var header string = `
@@ -47,33 +52,35 @@ func repl() {
 				continue
 			}
 			stmt := buf.String()
-			lxr = lexer.NewLexer(stmt)
+			lxr = lexer.NewFileLexer("<repl>", stmt)
 			tokens, err := lxr.GetTokens()
 			if err != nil {
-				fmt.Println(err.Error())
+				printError(os.Stdout, err, stmt)
 				buf.Reset()
 				continue
 			}
 			psr = parser.NewParser(tokens)
+			psr.KnownMacros(intr.IsMacro)
 			exprs, err := psr.GetExpressions()
 			if err != nil {
-				fmt.Println(err.Error())
+				printError(os.Stdout, err, stmt)
 				buf.Reset()
 				continue
 			}
 			res, err := intr.Interpret(exprs)
 			if err != nil {
-				fmt.Println(err.Error())
+				printError(os.Stdout, err, stmt)
 				buf.Reset()
 				continue
 			}
 
 			if res != nil {
-				fmt.Printf("%v\n", res)
+				fmt.Println(printer.Repr(res))
 			}
 			buf.Reset()
 		} else {
 			buf.WriteString(line)
+			buf.WriteString("\n")
 		}
 	}
 }
@@ -81,33 +88,54 @@ func repl() {
 func fromFile(filename string) {
 	dat, err := os.ReadFile(filename)
 	if err != nil {
-		errorQuit(err)
+		errorQuit(err, "")
 	} else {
-		lxr := lexer.NewLexer(string(dat))
+		source := string(dat)
+		lxr := lexer.NewFileLexer(filename, source)
 		tokens, err := lxr.GetTokens()
 		if err != nil {
-			errorQuit(err)
+			errorQuit(err, source)
 		}
 
 		prsr := parser.NewParser(tokens)
 		ast, err := prsr.GetExpressions()
 		if err != nil {
-			errorQuit(err)
+			errorQuit(err, source)
 		}
 
 		intr := interpreter.NewInterpreter()
 		_, err = intr.Interpret(ast)
 		if err != nil {
-			errorQuit(err)
+			errorQuit(err, source)
 		}
 	}
 }
 
-func errorQuit(err error) {
-	fmt.Fprintf(os.Stderr, "%v\n", err)
+func errorQuit(err error, source string) {
+	printError(os.Stderr, err, source)
 	os.Exit(1)
 }
 
+// printError prints an error followed by the offending source line when the
+// error carries a position. Runtime errors and throws from inside functions
+// are preceded by a traceback.
+func printError(w io.Writer, err error, source string) {
+	var rerr *interpreter.RuntimeError
+	var thrown *interpreter.ThrowError
+	if errors.As(err, &rerr) && len(rerr.Frames) > 0 {
+		fmt.Fprint(w, rerr.Traceback())
+	} else if errors.As(err, &thrown) && len(thrown.Frames) > 0 {
+		fmt.Fprint(w, thrown.Traceback())
+	}
+	fmt.Fprintf(w, "%v\n", err)
+	var positioned interface{ Position() token.Pos }
+	if errors.As(err, &positioned) {
+		if excerpt := token.Excerpt(source, positioned.Position()); excerpt != "" {
+			fmt.Fprintln(w, excerpt)
+		}
+	}
+}
+
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
@@ -1,76 +1,221 @@
+// Wrappergen generates DanLisp builtins for the functions of a Go package.
+//
+// Usage:
+//
+//	wrappergen [-funcs Name,Name...] [-out dir] package
+//
+// It loads the package from source and wraps each exported function whose
+// parameters and results danreflect.Wrap can convert, or only the functions
+// named by -funcs. Each function is registered as package/Function, as in
+// strings/Contains. The registrations are written to dir/<name>wrapper.go,
+// in package wrappers, as a Register<Name> function that adds them to an
+// environment. Arguments and results are converted by danreflect at run
+// time, the same way as for functions registered by hand.
 package main
 
 import (
-	"bufio"
+	"bytes"
+	_ "embed"
+	"flag"
 	"fmt"
+	"go/format"
+	"go/importer"
+	"go/token"
+	"go/types"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/template"
 )
 
-var TEMPLATE_DIR = "tmpl"
+//go:embed wrapper.tmpl
+var wrapperTemplate string
 
-type WrapperFnArgs struct {
-	Name string
-	Typ  string
+type Fn struct {
+	Symbol string
+	Pkg    string
+	Name   string
 }
 
-type WrapperFns struct {
-	Name     string
-	ArgTypes []string
+type Wrapper struct {
+	Path     string
+	Pkg      string
+	Register string
+	Fns      []Fn
 }
 
-type Wrapper struct {
-	Pkg string
-	Fns []WrapperFns
+var (
+	errorType = types.Universe.Lookup("error").Type()
+	bigInt    = [2]string{"math/big", "Int"}
+	bigRat    = [2]string{"math/big", "Rat"}
+)
+
+// param reports whether danreflect.Wrap can convert DanLisp values to type
+// t, which mirrors its rules: booleans, strings, numbers, interfaces,
+// *big.Int and *big.Rat, and slices, arrays and maps of those.
+func param(t types.Type) bool {
+	if isBig(t) {
+		return true
+	}
+	switch t := t.Underlying().(type) {
+	case *types.Basic:
+		return convertible(t)
+	case *types.Interface:
+		return true
+	case *types.Slice:
+		return param(t.Elem())
+	case *types.Array:
+		return param(t.Elem())
+	case *types.Map:
+		return param(t.Key()) && param(t.Elem())
+	}
+	return false
 }
 
-func main() {
-	stringsWrapper := Wrapper{
-		Pkg: "strings",
-		Fns: []WrapperFns{{
-			Name:     "Contains",
-			ArgTypes: []string{"string", "string"},
-		}, {
-			Name:     "Join",
-			ArgTypes: []string{"[]string", "string"},
-		}},
+// result reports whether danreflect.ToValue can convert values of type t.
+func result(t types.Type) bool {
+	if isBig(t) {
+		return true
+	}
+	switch t := t.Underlying().(type) {
+	case *types.Basic:
+		return convertible(t)
+	case *types.Slice:
+		return result(t.Elem())
+	case *types.Array:
+		return result(t.Elem())
+	case *types.Map:
+		return result(t.Key()) && result(t.Elem())
 	}
+	return false
+}
+
+func convertible(t *types.Basic) bool {
+	info := t.Info()
+	return info&(types.IsBoolean|types.IsString|types.IsInteger|types.IsFloat) != 0 && t.Kind() != types.UnsafePointer
+}
 
-	wrappers := []Wrapper{
-		stringsWrapper,
+// isBig reports whether t is *big.Int or *big.Rat.
+func isBig(t types.Type) bool {
+	ptr, ok := t.(*types.Pointer)
+	if !ok {
+		return false
 	}
+	named, ok := ptr.Elem().(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+	name := [2]string{named.Obj().Pkg().Path(), named.Obj().Name()}
+	return name == bigInt || name == bigRat
+}
 
-	fs := template.FuncMap{"arglist": func(argtypes []string) string {
-		argvs := make([]string, 0)
-		for i, el := range argtypes {
-			argvs = append(argvs, fmt.Sprintf("argv[%d].(%s)", i, el))
+// wrap describes the wrapper for a function, reporting false if it has a
+// parameter or result that can't be converted.
+func wrap(pkg *types.Package, f *types.Func) (Fn, bool) {
+	sig := f.Type().(*types.Signature)
+	if sig.TypeParams().Len() > 0 {
+		return Fn{}, false
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		if !param(sig.Params().At(i).Type()) {
+			return Fn{}, false
+		}
+	}
+	results := sig.Results()
+	for i := 0; i < results.Len(); i++ {
+		t := results.At(i).Type()
+		if i == results.Len()-1 && types.Identical(t, errorType) {
+			break
+		}
+		if !result(t) {
+			return Fn{}, false
 		}
-		return strings.Join(argvs, ",")
-	},
-		"lower": strings.ToLower}
-	t, err := template.New("wrapper.tmpl").Funcs(fs).ParseFiles("tmpl/wrapper.tmpl")
-	if err != nil {
-		log.Panic(err)
 	}
+	return Fn{Symbol: pkg.Name() + "/" + f.Name(), Pkg: pkg.Name(), Name: f.Name()}, true
+}
 
-	err = os.MkdirAll(".generated", os.ModePerm)
+func generate(path string, only []string) (Wrapper, error) {
+	pkg, err := importer.ForCompiler(token.NewFileSet(), "source", nil).Import(path)
 	if err != nil {
-		log.Panic(err)
+		return Wrapper{}, err
+	}
+	wrapper := Wrapper{
+		Path:     path,
+		Pkg:      pkg.Name(),
+		Register: "Register" + strings.ToUpper(pkg.Name()[:1]) + pkg.Name()[1:],
 	}
 
-	for _, wrapper := range wrappers {
-		f, err := os.Create(".generated/" + wrapper.Pkg + "wrapper.go")
-		if err != nil {
-			log.Panic(err)
+	names := only
+	if len(names) == 0 {
+		names = pkg.Scope().Names()
+	}
+	for _, name := range names {
+		f, ok := pkg.Scope().Lookup(name).(*types.Func)
+		if !ok || !f.Exported() {
+			if len(only) > 0 {
+				return Wrapper{}, fmt.Errorf("%v has no exported function %v", path, name)
+			}
+			continue
 		}
-		defer f.Close()
-		b := bufio.NewWriter(f)
-		err = t.Execute(b, wrapper)
-		if err != nil {
-			log.Panic(err)
+		fn, ok := wrap(pkg, f)
+		if !ok {
+			if len(only) > 0 {
+				return Wrapper{}, fmt.Errorf("can't wrap %v.%v: unsupported signature %v", path, name, f.Type())
+			}
+			continue
 		}
-		b.Flush()
+		wrapper.Fns = append(wrapper.Fns, fn)
+	}
+	if len(wrapper.Fns) == 0 {
+		return Wrapper{}, fmt.Errorf("%v has no functions that can be wrapped", path)
+	}
+	return wrapper, nil
+}
+
+// render executes the wrapper template and formats the result.
+func render(wrapper Wrapper) ([]byte, error) {
+	t, err := template.New("wrapper").Parse(wrapperTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, wrapper); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "%s [flags] package\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	funcs := flag.String("funcs", "", "comma separated `names` of the functions to wrap, instead of every one that can be")
+	out := flag.String("out", ".", "`directory` to write the wrapper to")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var only []string
+	if *funcs != "" {
+		only = strings.Split(*funcs, ",")
+	}
+	wrapper, err := generate(flag.Arg(0), only)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src, err := render(wrapper)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	filename := filepath.Join(*out, strings.ToLower(wrapper.Pkg)+"wrapper.go")
+	if err := os.WriteFile(filename, src, 0o644); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	wrapper, err := generate("strconv", []string{"Itoa", "ParseBool", "QuoteRune"})
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	if wrapper.Register != "RegisterStrconv" {
+		t.Fatalf("Expected RegisterStrconv but got %v", wrapper.Register)
+	}
+	expected := []Fn{
+		{Symbol: "strconv/Itoa", Pkg: "strconv", Name: "Itoa"},
+		{Symbol: "strconv/ParseBool", Pkg: "strconv", Name: "ParseBool"},
+		{Symbol: "strconv/QuoteRune", Pkg: "strconv", Name: "QuoteRune"},
+	}
+	if !reflect.DeepEqual(expected, wrapper.Fns) {
+		t.Fatalf("Expected %+v but got %+v", expected, wrapper.Fns)
+	}
+}
+
+func TestGenerateFollowsDanreflect(t *testing.T) {
+	// Variadic functions, named types and big numbers can be converted.
+	for _, fn := range [][2]string{{"path", "Join"}, {"time", "Sleep"}, {"math/big", "Jacobi"}} {
+		if _, err := generate(fn[0], []string{fn[1]}); err != nil {
+			t.Fatalf("Expected %v.%v to be wrapped but got %v", fn[0], fn[1], err)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	wrapper, err := generate("strings", []string{"Contains", "Fields"})
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	src, err := render(wrapper)
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	for _, want := range []string{
+		"func RegisterStrings(env map[string]interface{}) {",
+		`"strings/Contains": strings.Contains,`,
+		`"strings/Fields":   strings.Fields,`,
+		"danreflect.RegisterFunc(env, name, fn)",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Fatalf("Expected the wrapper to contain %q but got\n%s", want, src)
+		}
+	}
+}
+
+func TestGenerateSkipsUnsupported(t *testing.T) {
+	wrapper, err := generate("strings", nil)
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	names := map[string]bool{}
+	for _, fn := range wrapper.Fns {
+		names[fn.Name] = true
+	}
+	if !names["Contains"] || !names["Join"] {
+		t.Fatalf("Expected Contains and Join to be wrapped but got %v", names)
+	}
+	// Function parameters, pointer results and named types can't be converted.
+	for _, name := range []string{"IndexFunc", "NewReader", "ToUpperSpecial"} {
+		if names[name] {
+			t.Fatalf("Expected %v to be skipped", name)
+		}
+	}
+
+	if _, err := generate("strings", []string{"IndexFunc"}); err == nil {
+		t.Fatal("Expected an error asking for an unsupported function")
+	}
+	if _, err := generate("strings", []string{"Missing"}); err == nil {
+		t.Fatal("Expected an error asking for a missing function")
+	}
+}
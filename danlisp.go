@@ -0,0 +1,212 @@
+// Package danlisp embeds the DanLisp interpreter in Go programs.
+//
+// An Interpreter keeps its global variables between calls, so a program can
+// define functions with one call to Eval and use them from later ones or
+// from Go through Call and CallContext.
+//
+//	lisp, err := danlisp.New(danlisp.WithGlobal("limit", 10))
+//	...
+//	_, err = lisp.Eval(ctx, "(defn double (x) (* x 2))")
+//	...
+//	val, err := lisp.Call("double", 21) // int64(42)
+//
+// Values cross between Go and DanLisp following the rules of ToValue and
+// FromValue.
+package danlisp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/danwhitford/danlisp/internal/interpreter"
+	"github.com/danwhitford/danlisp/internal/lexer"
+	"github.com/danwhitford/danlisp/internal/parser"
+	"github.com/danwhitford/danlisp/internal/stdlib/builtin"
+	"github.com/danwhitford/danlisp/internal/stdlib/danreflect"
+	"github.com/danwhitford/danlisp/internal/token"
+)
+
+// Errors returned by the interpreter. Errors from lexing and parsing are
+// *SyntaxError, failures while running are *RuntimeError and a value thrown
+// with throw that nothing caught is a *ThrowError. All of them report the
+// position in the source that caused them.
+type (
+	SyntaxError  = token.Error
+	RuntimeError = interpreter.RuntimeError
+	ThrowError   = interpreter.ThrowError
+	Frame        = interpreter.Frame
+	Pos          = token.Pos
+)
+
+// Limits bounds the work done by each call to Eval or EvalFile. A limit of
+// zero means there is none, except for Depth, which is DefaultDepth unless
+// set.
+type Limits = interpreter.Limits
+
+// DefaultDepth is how deeply function calls can nest when Limits doesn't
+// say. Deeper recursion would overflow the Go stack and crash the program.
+const DefaultDepth = interpreter.DefaultDepth
+
+// ErrLimitExceeded is wrapped by the error returned when a program goes over
+// its Limits.
+var ErrLimitExceeded = interpreter.ErrLimitExceeded
+
+// Interpreter runs DanLisp source. It is not safe for concurrent use.
+type Interpreter struct {
+	intr interpreter.Interpreter
+}
+
+// Option configures an Interpreter.
+type Option func(*Interpreter) error
+
+// WithGlobal defines a global variable before any source is evaluated. The
+// value is converted in the same way as by Define, and New returns the error
+// if it can't be.
+func WithGlobal(name string, value interface{}) Option {
+	return func(interp *Interpreter) error {
+		return interp.Define(name, value)
+	}
+}
+
+// WithStdout sets where prn and print write to. It is os.Stdout by default.
+func WithStdout(w io.Writer) Option {
+	return func(interp *Interpreter) error {
+		interp.intr.Stdout = w
+		return nil
+	}
+}
+
+// WithStderr sets where eprn writes to. It is os.Stderr by default.
+func WithStderr(w io.Writer) Option {
+	return func(interp *Interpreter) error {
+		interp.intr.Stderr = w
+		return nil
+	}
+}
+
+// WithStdin sets where read-line and read-all read from. It is os.Stdin by
+// default.
+func WithStdin(r io.Reader) Option {
+	return func(interp *Interpreter) error {
+		interp.intr.Stdin = r
+		return nil
+	}
+}
+
+// WithLimits bounds the steps, call depth and cons cells each evaluation
+// can use, for running code that can't be trusted to finish.
+func WithLimits(limits Limits) Option {
+	return func(interp *Interpreter) error {
+		if limits.Depth == 0 {
+			limits.Depth = DefaultDepth
+		}
+		interp.intr.Limits = limits
+		return nil
+	}
+}
+
+// New returns an interpreter with the standard library loaded, or the
+// error from the first option that can't be applied.
+func New(opts ...Option) (*Interpreter, error) {
+	interp := &Interpreter{intr: interpreter.NewInterpreter()}
+	for _, opt := range opts {
+		if err := opt(interp); err != nil {
+			return nil, err
+		}
+	}
+	return interp, nil
+}
+
+// Eval runs src and returns the value of its last expression converted with
+// FromValue. Once ctx is done evaluation stops with a *RuntimeError wrapping
+// the context's error. Going over the interpreter's Limits stops it with one
+// wrapping ErrLimitExceeded. Scripts can't catch either error.
+func (interp *Interpreter) Eval(ctx context.Context, src string) (interface{}, error) {
+	return interp.eval(ctx, lexer.NewLexer(src))
+}
+
+// EvalFile reads and runs a source file. Errors report positions in that
+// file.
+func (interp *Interpreter) EvalFile(ctx context.Context, filename string) (interface{}, error) {
+	dat, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return interp.eval(ctx, lexer.NewFileLexer(filename, string(dat)))
+}
+
+func (interp *Interpreter) eval(ctx context.Context, lxr lexer.Lexer) (interface{}, error) {
+	tokens, err := lxr.GetTokens()
+	if err != nil {
+		return nil, err
+	}
+	psr := parser.NewParser(tokens)
+	psr.KnownMacros(interp.intr.IsMacro)
+	exprs, err := psr.GetExpressions()
+	if err != nil {
+		return nil, err
+	}
+	val, err := interp.intr.InterpretContext(ctx, exprs)
+	if err != nil {
+		return nil, err
+	}
+	return FromValue(val), nil
+}
+
+// Define sets a global variable to value, converted with ToValue. Go
+// functions report errors under name.
+func (interp *Interpreter) Define(name string, value interface{}) error {
+	var val interface{}
+	var err error
+	if _, ok := value.(Builtin); !ok && reflect.ValueOf(value).Kind() == reflect.Func {
+		val, err = danreflect.Wrap(name, value)
+	} else {
+		val, err = ToValue(value)
+	}
+	if err != nil {
+		return err
+	}
+	interp.intr.Define(name, val)
+	return nil
+}
+
+// Get returns the value of a global variable converted with FromValue, and
+// whether it is defined.
+func (interp *Interpreter) Get(name string) (interface{}, bool) {
+	val, ok := interp.intr.Lookup(name)
+	if !ok {
+		return nil, false
+	}
+	return FromValue(val), true
+}
+
+// Call calls the function bound to a global variable. The arguments are
+// converted with ToValue and the result with FromValue.
+func (interp *Interpreter) Call(fnName string, args ...interface{}) (interface{}, error) {
+	return interp.CallContext(context.Background(), fnName, args...)
+}
+
+// CallContext is like Call but stops the function once ctx is done, and
+// applies the interpreter's Limits, in the same way as Eval.
+func (interp *Interpreter) CallContext(ctx context.Context, fnName string, args ...interface{}) (interface{}, error) {
+	fn, ok := interp.intr.Lookup(fnName)
+	if !ok {
+		return nil, &RuntimeError{Kind: builtin.UnboundSymbol, Msg: fmt.Sprintf("runtime error. Could not find symbol '%v'", fnName)}
+	}
+	argv := make([]interface{}, len(args))
+	for i, arg := range args {
+		val, err := ToValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d to %v: %w", i+1, fnName, err)
+		}
+		argv[i] = val
+	}
+	val, err := interp.intr.ApplyContext(ctx, fn, argv)
+	if err != nil {
+		return nil, err
+	}
+	return FromValue(val), nil
+}
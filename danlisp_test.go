@@ -0,0 +1,306 @@
+package danlisp
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustNew(t *testing.T, opts ...Option) *Interpreter {
+	lisp, err := New(opts...)
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	return lisp
+}
+
+func TestEval(t *testing.T) {
+	lisp := mustNew(t)
+	val, err := lisp.Eval(context.Background(), "(defn square (x) (* x x)) (square 7)")
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	if val != int64(49) {
+		t.Fatalf("Expected 49 but got %v", val)
+	}
+	// Definitions last between calls.
+	val, err = lisp.Eval(context.Background(), "(list (square 2) \"a\" true nil)")
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	expected := []interface{}{int64(4), "a", true, nil}
+	if !reflect.DeepEqual(expected, val) {
+		t.Fatalf("Expected %v but got %v", expected, val)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	lisp := mustNew(t)
+	_, err := lisp.Eval(context.Background(), "(+ 1")
+	var serr *SyntaxError
+	if !errors.As(err, &serr) {
+		t.Fatalf("Expected a syntax error but got %v", err)
+	}
+
+	_, err = lisp.Eval(context.Background(), "\n(car 5)")
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("Expected a runtime error but got %v", err)
+	}
+	if rerr.Pos.Line != 2 {
+		t.Fatalf("Expected error on line 2 but got %v", rerr.Pos)
+	}
+
+	_, err = lisp.Eval(context.Background(), "(throw \"oops\")")
+	var thrown *ThrowError
+	if !errors.As(err, &thrown) || thrown.Value != "oops" {
+		t.Fatalf("Expected a throw of oops but got %v", err)
+	}
+}
+
+func TestEvalCancelled(t *testing.T) {
+	lisp := mustNew(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := lisp.Eval(ctx, "(set x 1)")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled but got %v", err)
+	}
+	if _, ok := lisp.Get("x"); ok {
+		t.Fatal("Expected nothing to be evaluated")
+	}
+}
+
+func TestEvalFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "prog.dan")
+	if err := os.WriteFile(filename, []byte("(set x 1)\n(car x)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := mustNew(t).EvalFile(context.Background(), filename)
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("Expected a runtime error but got %v", err)
+	}
+	if rerr.Pos.File != filename || rerr.Pos.Line != 2 {
+		t.Fatalf("Expected error at %v:2 but got %v", filename, rerr.Pos)
+	}
+}
+
+func TestDefineGetCall(t *testing.T) {
+	lisp := mustNew(t, WithGlobal("greeting", "hello"))
+	if err := lisp.Define("nums", []int{1, 2, 3}); err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	if err := lisp.Define("shout", func(argv []interface{}) (interface{}, error) {
+		return argv[0].(string) + "!", nil
+	}); err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	_, err := lisp.Eval(context.Background(), "(defn total (xs) (if xs (+ (car xs) (total (cdr xs))) 0))")
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+
+	val, err := lisp.Call("total", []float64{1.5, 2})
+	if err != nil || val != 3.5 {
+		t.Fatalf("Expected 3.5 but got %v, %v", val, err)
+	}
+	val, err = lisp.Call("shout", "hello")
+	if err != nil || val != "hello!" {
+		t.Fatalf("Expected hello! but got %v, %v", val, err)
+	}
+	val, err = lisp.Eval(context.Background(), "(shout greeting)")
+	if err != nil || val != "hello!" {
+		t.Fatalf("Expected hello! but got %v, %v", val, err)
+	}
+	if val, ok := lisp.Get("nums"); !ok || !reflect.DeepEqual(val, []interface{}{int64(1), int64(2), int64(3)}) {
+		t.Fatalf("Expected (1 2 3) but got %v", val)
+	}
+	if _, ok := lisp.Get("missing"); ok {
+		t.Fatal("Expected missing to be undefined")
+	}
+
+	// Functions can be passed back in.
+	total, _ := lisp.Get("total")
+	if _, ok := total.(Function); !ok {
+		t.Fatalf("Expected a Function but got %T", total)
+	}
+	lisp.Define("sum", total)
+	val, err = lisp.Eval(context.Background(), "(sum nums)")
+	if err != nil || val != int64(6) {
+		t.Fatalf("Expected 6 but got %v, %v", val, err)
+	}
+
+	if _, err := New(WithGlobal("ch", make(chan int))); err == nil {
+		t.Fatal("Expected an error defining a channel")
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	lisp := mustNew(t)
+	lisp.Eval(context.Background(), "(defn f (x) (return x)) (set n 1)")
+	if val, err := lisp.Call("f", 1); err != nil || val != int64(1) {
+		t.Fatalf("Expected 1 but got %v, %v", val, err)
+	}
+	var rerr *RuntimeError
+	if _, err := lisp.Call("f"); !errors.As(err, &rerr) || rerr.Kind != "arity-error" {
+		t.Fatalf("Expected an arity error but got %v", err)
+	}
+	if _, err := lisp.Call("missing"); !errors.As(err, &rerr) || rerr.Kind != "unbound-symbol" {
+		t.Fatal("Expected an error calling an undefined function")
+	}
+	if _, err := lisp.Call("n"); err == nil {
+		t.Fatal("Expected an error calling a number")
+	}
+	if _, err := lisp.Call("f", struct{}{}); err == nil {
+		t.Fatal("Expected an error converting a struct")
+	}
+}
+
+func TestCallContext(t *testing.T) {
+	lisp := mustNew(t)
+	if _, err := lisp.Eval(context.Background(), "(defn spin () (while t 1))"); err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := lisp.CallContext(ctx, "spin")
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to be exceeded but got %v", err)
+	}
+
+	// Calls are bounded by the interpreter's limits too.
+	lisp = mustNew(t, WithLimits(Limits{Steps: 1000}))
+	lisp.Eval(context.Background(), "(defn spin () (while t 1))")
+	if _, err := lisp.Call("spin"); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected the limit to be exceeded but got %v", err)
+	}
+}
+
+func TestToValue(t *testing.T) {
+	values := []interface{}{nil, true, "s", 3, int8(-3), uint16(3), uint64(math.MaxUint64), float32(0.5), big.NewInt(7), big.NewRat(4, 2), []string{}}
+	expected := []interface{}{nil, true, "s", int64(3), int64(-3), int64(3), new(big.Int).SetUint64(math.MaxUint64), 0.5, int64(7), int64(2), nil}
+	for i, v := range values {
+		got, err := ToValue(v)
+		if err != nil {
+			t.Fatalf("Not expecting error but got %v", err)
+		}
+		if !reflect.DeepEqual(expected[i], got) {
+			t.Fatalf("Expected %v (%T) but got %v (%T)", expected[i], expected[i], got, got)
+		}
+	}
+
+	got, err := ToValue(map[string]int{"b": 2, "a": 1})
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	if s := got.(Pair).String(); s != `(("a" 1) ("b" 2))` {
+		t.Fatalf("Expected an association list but got %v", s)
+	}
+
+	if _, err := ToValue(make(chan int)); err == nil {
+		t.Fatal("Expected an error converting a channel")
+	}
+}
+
+func TestFromValue(t *testing.T) {
+	lisp := mustNew(t)
+	val, err := lisp.Eval(context.Background(), "(list 1 (list 2 3) 'a (cons 1 2))")
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	expected := []interface{}{int64(1), []interface{}{int64(2), int64(3)}, Symbol{Name: "a"}, Pair{Car: int64(1), Cdr: int64(2)}}
+	if !reflect.DeepEqual(expected, val) {
+		t.Fatalf("Expected %v but got %v", expected, val)
+	}
+}
+
+func TestDefineGoFunction(t *testing.T) {
+	lisp := mustNew(t)
+	lisp.Define("repeat", strings.Repeat)
+	lisp.Define("parse-int", strconv.Atoi)
+	lisp.Define("sum", func(xs ...float64) float64 {
+		total := 0.0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	})
+
+	val, err := lisp.Eval(context.Background(), `(list (repeat "ab" 2) (parse-int "42") (sum 1 2 1/2))`)
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	expected := []interface{}{"abab", int64(42), 3.5}
+	if !reflect.DeepEqual(expected, val) {
+		t.Fatalf("Expected %v but got %v", expected, val)
+	}
+
+	_, err = lisp.Eval(context.Background(), `(parse-int "x")`)
+	var rerr *RuntimeError
+	var nerr *strconv.NumError
+	if !errors.As(err, &rerr) || !errors.As(err, &nerr) {
+		t.Fatalf("Expected a runtime error wrapping a NumError but got %v", err)
+	}
+	if rerr.Msg != `runtime error. 'parse-int' failed: strconv.Atoi: parsing "x": invalid syntax` {
+		t.Fatalf("Unexpected message %v", rerr.Msg)
+	}
+
+	val, err = lisp.Eval(context.Background(), `(try (repeat 2 "ab") (catch e (error-kind e)))`)
+	if err != nil || val != "type-error" {
+		t.Fatalf("Expected a type-error but got %v, %v", val, err)
+	}
+
+	if err := lisp.Define("bad", func(c chan int) {}); err == nil {
+		t.Fatal("Expected an error defining a function taking a channel")
+	}
+}
+
+func TestStreams(t *testing.T) {
+	var stdout, stderr strings.Builder
+	lisp := mustNew(t, WithStdout(&stdout), WithStderr(&stderr), WithStdin(strings.NewReader("Dan\n")))
+	_, err := lisp.Eval(context.Background(), `(prn "Hello" (read-line)) (eprn "bye")`)
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	if stdout.String() != "Hello Dan\n" || stderr.String() != "bye\n" {
+		t.Fatalf("Unexpected output %q and %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestLimits(t *testing.T) {
+	lisp := mustNew(t, WithLimits(Limits{Steps: 10000, Depth: 100}))
+	_, err := lisp.Eval(context.Background(), "(while t 1)")
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected the limit to be exceeded but got %v", err)
+	}
+	_, err = lisp.Eval(context.Background(), "(defn f (n) (+ 1 (f n))) (f 1)")
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected the limit to be exceeded but got %v", err)
+	}
+
+	// Calls nest at most DefaultDepth deep unless the limits say otherwise.
+	for _, lisp := range []*Interpreter{mustNew(t), mustNew(t, WithLimits(Limits{Steps: 1_000_000}))} {
+		_, err = lisp.Eval(context.Background(), "(defn f (n) (if (= n 0) 0 (+ 1 (f (- n 1))))) (f 10000000)")
+		var rerr *RuntimeError
+		if !errors.As(err, &rerr) || !errors.Is(err, ErrLimitExceeded) {
+			t.Fatalf("Expected a runtime error for exceeding the depth limit but got %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = mustNew(t).Eval(ctx, "(while t 1)")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to be exceeded but got %v", err)
+	}
+}
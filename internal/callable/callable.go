@@ -1,11 +1,37 @@
 package callable
 
 import (
+	"github.com/danwhitford/danlisp/internal/environment"
 	"github.com/danwhitford/danlisp/internal/expr"
 )
 
 type Callable struct {
-	Arity int
-	Args  []string
-	Body  []expr.Expr
+	Name     string
+	Arity    int
+	Args     []string
+	Optional []expr.Optional
+	Rest     string
+	Body     []expr.Expr
+	Closure  *environment.Environment
+}
+
+// Variadic reports whether the callable collects extra arguments into a
+// rest parameter.
+func (callable Callable) Variadic() bool {
+	return callable.Rest != ""
+}
+
+// MaxArity is the most arguments the callable accepts, or -1 if there is
+// no limit.
+func (callable Callable) MaxArity() int {
+	if callable.Variadic() {
+		return -1
+	}
+	return callable.Arity + len(callable.Optional)
+}
+
+// Macro is a callable that is applied to the unevaluated forms of its
+// arguments and returns a new form to be evaluated in place of the call.
+type Macro struct {
+	Callable Callable
 }
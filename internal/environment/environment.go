@@ -0,0 +1,54 @@
+package environment
+
+// Environment is a single frame of variable bindings. Frames are chained
+// through their parent so that lookups fall back to enclosing scopes.
+type Environment struct {
+	values map[string]interface{}
+	parent *Environment
+}
+
+func NewEnvironment(parent *Environment) *Environment {
+	return &Environment{
+		values: make(map[string]interface{}),
+		parent: parent,
+	}
+}
+
+// NewGlobalEnvironment wraps an existing set of bindings as a root frame.
+func NewGlobalEnvironment(values map[string]interface{}) *Environment {
+	return &Environment{
+		values: values,
+		parent: nil,
+	}
+}
+
+func (env *Environment) Parent() *Environment {
+	return env.parent
+}
+
+// Get looks up a name in this frame and then in each enclosing frame.
+func (env *Environment) Get(name string) (interface{}, bool) {
+	for e := env; e != nil; e = e.parent {
+		if val, ok := e.values[name]; ok {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// Define binds a name in this frame, shadowing any outer binding.
+func (env *Environment) Define(name string, val interface{}) {
+	env.values[name] = val
+}
+
+// Set assigns to the nearest existing binding of name. If there is none
+// the name is defined in this frame.
+func (env *Environment) Set(name string, val interface{}) {
+	for e := env; e != nil; e = e.parent {
+		if _, ok := e.values[name]; ok {
+			e.values[name] = val
+			return
+		}
+	}
+	env.values[name] = val
+}
@@ -1,39 +1,172 @@
 package expr
 
+import "github.com/danwhitford/danlisp/internal/token"
+
 type Expr interface{}
 
 type Atom struct {
 	Value interface{}
+	Pos   token.Pos
 }
 
 type Seq struct {
 	Exprs []Expr
+	Pos   token.Pos
+	// Tokens is the source of the whole sequence, brackets included, kept
+	// so that macros can be handed their arguments as unevaluated data.
+	Tokens []token.Token
+	// Err is set when the arguments could not be parsed as expressions, in
+	// which case Exprs holds only the head symbol. The call may be to a
+	// macro, which is handed its arguments as data, so the error is only
+	// reported if it turns out not to be.
+	Err error
+	// Expansion caches the expansion of a call to a macro. It is shared by
+	// every copy of the Seq so the call is expanded once however many times
+	// the code runs, and is nil when the head isn't a symbol.
+	Expansion *Expansion
+}
+
+// Expansion is the expansion of a call to a macro. Macro identifies the
+// macro that produced it, so that the call is expanded again if the name is
+// bound to a different macro.
+type Expansion struct {
+	Macro interface{}
+	Expr  Expr
 }
 
 type Symbol struct {
 	Name string
+	Pos  token.Pos
 }
 
 type Set struct {
 	Var   Symbol
 	Value Expr
+	Pos   token.Pos
 }
 
+// If has a nil FalseBranch when the else branch is left out.
 type If struct {
 	Cond        Expr
 	TrueBranch  Expr
 	FalseBranch Expr
+	Pos         token.Pos
+}
+
+type Cond struct {
+	Clauses []Clause
+	Pos     token.Pos
+}
+
+// Clause is a single branch of a cond. An else clause has a nil Test. A
+// clause with an empty body evaluates to the value of its test.
+type Clause struct {
+	Test Expr
+	Body []Expr
+}
+
+type When struct {
+	Cond Expr
+	Body []Expr
+	Pos  token.Pos
+}
+
+type Unless struct {
+	Cond Expr
+	Body []Expr
+	Pos  token.Pos
+}
+
+type Do struct {
+	Body []Expr
+	Pos  token.Pos
+}
+
+// Return leaves the innermost function. Value is nil for a bare (return).
+type Return struct {
+	Value Expr
+	Pos   token.Pos
+}
+
+// Break leaves the innermost loop.
+type Break struct {
+	Pos token.Pos
+}
+
+// Continue skips to the next iteration of the innermost loop.
+type Continue struct {
+	Pos token.Pos
+}
+
+// Try evaluates Body, handling errors with Catch if it is present and then
+// always evaluating Finally.
+type Try struct {
+	Body    []Expr
+	Catch   *Catch
+	Finally []Expr
+	Pos     token.Pos
+}
+
+// Catch binds a caught error to Var while evaluating Body.
+type Catch struct {
+	Var  Symbol
+	Body []Expr
+}
+
+type Throw struct {
+	Value Expr
+	Pos   token.Pos
+}
+
+// And evaluates Exprs until one is false.
+type And struct {
+	Exprs []Expr
+	Pos   token.Pos
+}
+
+// Or evaluates Exprs until one is true.
+type Or struct {
+	Exprs []Expr
+	Pos   token.Pos
 }
 
 type While struct {
 	Cond Expr
 	Body []Expr
+	Pos  token.Pos
 }
 
 type Defn struct {
 	Name    Symbol
-	Arglist []Symbol
+	Arglist Arglist
+	Body    []Expr
+	Pos     token.Pos
+}
+
+type Defmacro struct {
+	Name    Symbol
+	Arglist Arglist
+	Body    []Expr
+	Pos     token.Pos
+}
+
+// Arglist holds the parameters of a function. Optional parameters follow
+// an &optional marker and a single rest parameter follows &rest.
+type Arglist struct {
+	Required []Symbol
+	Optional []Optional
+	Rest     *Symbol
+}
+
+type Optional struct {
+	Var     Symbol
+	Default Expr
+}
+
+type Fn struct {
+	Arglist Arglist
 	Body    []Expr
+	Pos     token.Pos
 }
 
 type For struct {
@@ -41,4 +174,99 @@ type For struct {
 	Cond        Expr
 	Step        Expr
 	Body        []Expr
+	Pos         token.Pos
+}
+
+// Let introduces local bindings for the duration of its body. When
+// Sequential is set, as for let*, each value can see the bindings before it.
+type Let struct {
+	Bindings   []Binding
+	Body       []Expr
+	Sequential bool
+	Pos        token.Pos
+}
+
+type Binding struct {
+	Var   Symbol
+	Value Expr
+}
+
+// Quote is a literal piece of data: a value, a symbol.Symbol or a list of
+// them built from cons cells.
+type Quote struct {
+	Datum interface{}
+	Pos   token.Pos
+}
+
+// Quasiquote is a data template. Its Template is quoted data that may
+// contain Unquote values, and cons cells whose car is an UnquoteSplicing,
+// to be filled in when the quasiquote is evaluated.
+type Quasiquote struct {
+	Template interface{}
+	Pos      token.Pos
+}
+
+type Unquote struct {
+	Expr Expr
+	Pos  token.Pos
+}
+
+type UnquoteSplicing struct {
+	Expr Expr
+	Pos  token.Pos
+}
+
+// PosOf returns the source position of an expression, if it has one.
+func PosOf(ex Expr) token.Pos {
+	switch v := ex.(type) {
+	case Atom:
+		return v.Pos
+	case Seq:
+		return v.Pos
+	case Symbol:
+		return v.Pos
+	case Set:
+		return v.Pos
+	case If:
+		return v.Pos
+	case Cond:
+		return v.Pos
+	case When:
+		return v.Pos
+	case Unless:
+		return v.Pos
+	case Do:
+		return v.Pos
+	case Return:
+		return v.Pos
+	case Break:
+		return v.Pos
+	case Continue:
+		return v.Pos
+	case Try:
+		return v.Pos
+	case And:
+		return v.Pos
+	case Or:
+		return v.Pos
+	case Throw:
+		return v.Pos
+	case While:
+		return v.Pos
+	case Defn:
+		return v.Pos
+	case Defmacro:
+		return v.Pos
+	case Fn:
+		return v.Pos
+	case For:
+		return v.Pos
+	case Let:
+		return v.Pos
+	case Quote:
+		return v.Pos
+	case Quasiquote:
+		return v.Pos
+	}
+	return token.Pos{}
 }
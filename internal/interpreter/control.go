@@ -0,0 +1,174 @@
+package interpreter
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/danwhitford/danlisp/internal/environment"
+	"github.com/danwhitford/danlisp/internal/expr"
+	"github.com/danwhitford/danlisp/internal/stdlib/builtin"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/errorvalue"
+	"github.com/danwhitford/danlisp/internal/token"
+)
+
+// A signal is non-local control flow. Signals travel up the Go stack as
+// errors until they reach the function or loop they leave, so every
+// evaluation path passes them on without further plumbing.
+type signal interface {
+	error
+	position() token.Pos
+}
+
+type returnSignal struct {
+	value interface{}
+	pos   token.Pos
+}
+
+func (sig *returnSignal) Error() string {
+	return "runtime error. return outside of a function"
+}
+
+func (sig *returnSignal) position() token.Pos {
+	return sig.pos
+}
+
+type breakSignal struct {
+	pos token.Pos
+}
+
+func (sig *breakSignal) Error() string {
+	return "runtime error. break outside of a loop"
+}
+
+func (sig *breakSignal) position() token.Pos {
+	return sig.pos
+}
+
+type continueSignal struct {
+	pos token.Pos
+}
+
+func (sig *continueSignal) Error() string {
+	return "runtime error. continue outside of a loop"
+}
+
+func (sig *continueSignal) position() token.Pos {
+	return sig.pos
+}
+
+// uncaught converts a signal that escaped the forms it could leave into a
+// runtime error. Other errors are returned unchanged.
+func (interpreter *Interpreter) uncaught(err error) error {
+	if sig, ok := err.(signal); ok {
+		return interpreter.runtimeError(errors.New(sig.Error()), sig.position())
+	}
+	return err
+}
+
+// leaveFunction finishes a function call. A return becomes the value of the
+// call, while a break or continue has no loop left to leave.
+func (interpreter *Interpreter) leaveFunction(val interface{}, err error) (interface{}, error) {
+	if ret, ok := err.(*returnSignal); ok {
+		return ret.value, nil
+	}
+	return val, interpreter.uncaught(err)
+}
+
+func (interpreter *Interpreter) evalThrow(ex expr.Throw) (interface{}, error) {
+	val, err := interpreter.eval(ex.Value)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &ThrowError{Pos: ex.Pos, Value: val, Frames: interpreter.frames()}
+}
+
+// evalTry evaluates the body of a try, passing any error it can catch to
+// the catch clause. The finally clause runs however the body is left,
+// including by return, break or continue, unless evaluation is being
+// stopped.
+func (interpreter *Interpreter) evalTry(ex expr.Try) (interface{}, error) {
+	val, err := interpreter.evalAll(ex.Body)
+	if err != nil && ex.Catch != nil {
+		if caught, ok := interpreter.caught(err, ex.Pos); ok {
+			val, err = interpreter.evalCatch(*ex.Catch, caught)
+		}
+	}
+	if ex.Finally != nil && !isStop(err) {
+		if _, ferr := interpreter.evalAll(ex.Finally); ferr != nil {
+			return nil, ferr
+		}
+	}
+	return val, err
+}
+
+func (interpreter *Interpreter) evalCatch(catch expr.Catch, caught interface{}) (interface{}, error) {
+	caller := interpreter.environment
+	defer func() {
+		interpreter.environment = caller
+	}()
+	frame := environment.NewEnvironment(caller)
+	frame.Define(catch.Var.Name, caught)
+	interpreter.environment = frame
+	return interpreter.evalAll(catch.Body)
+}
+
+// caught returns the value a catch clause binds for err. A thrown value is
+// passed on as it is, and runtime errors become error values. Control flow
+// signals and errors that stop evaluation are not caught.
+func (interpreter *Interpreter) caught(err error, pos token.Pos) (interface{}, bool) {
+	if _, ok := err.(signal); ok || isStop(err) {
+		return nil, false
+	}
+	var thrown *ThrowError
+	if errors.As(err, &thrown) {
+		return thrown.Value, true
+	}
+	var rerr *RuntimeError
+	if !errors.As(interpreter.runtimeError(err, pos), &rerr) {
+		return nil, false
+	}
+	return errorvalue.Error{
+		Kind:    rerr.Kind,
+		Message: strings.TrimPrefix(rerr.Msg, "runtime error. "),
+		Pos:     rerr.Pos,
+	}, true
+}
+
+// registerErrorValues adds the builtins that inspect caught errors.
+func registerErrorValues(env map[string]interface{}) {
+	env["error?"] = func(argv []interface{}) (interface{}, error) {
+		if err := builtin.Arity("error?", argv, 1); err != nil {
+			return nil, err
+		}
+		_, ok := argv[0].(errorvalue.Error)
+		return ok, nil
+	}
+
+	env["error-message"] = errorAccessor("error-message", func(err errorvalue.Error) interface{} {
+		return err.Message
+	})
+
+	env["error-kind"] = errorAccessor("error-kind", func(err errorvalue.Error) interface{} {
+		return err.Kind
+	})
+
+	env["error-position"] = errorAccessor("error-position", func(err errorvalue.Error) interface{} {
+		if !err.Pos.IsValid() {
+			return nil
+		}
+		return err.Pos.String()
+	})
+}
+
+func errorAccessor(name string, get func(errorvalue.Error) interface{}) func([]interface{}) (interface{}, error) {
+	return func(argv []interface{}) (interface{}, error) {
+		if err := builtin.Arity(name, argv, 1); err != nil {
+			return nil, err
+		}
+		err, ok := argv[0].(errorvalue.Error)
+		if !ok {
+			return nil, builtin.ArgTypeError(name, "error", argv, 0)
+		}
+		return get(err), nil
+	}
+}
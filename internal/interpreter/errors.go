@@ -0,0 +1,138 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/danwhitford/danlisp/internal/printer"
+	"github.com/danwhitford/danlisp/internal/stdlib/builtin"
+	"github.com/danwhitford/danlisp/internal/token"
+)
+
+// Frame is an active function call at the time an error was raised.
+type Frame struct {
+	Name string
+	Pos  token.Pos
+}
+
+func (frame Frame) String() string {
+	name := frame.Name
+	if name == "" {
+		name = "anonymous function"
+	}
+	return fmt.Sprintf("%v: in %v", frame.Pos, name)
+}
+
+// RuntimeError is an error raised while evaluating a program. Kind
+// classifies the error, such as "type-error", and is "error" when there is
+// nothing more specific. Frames lists the function calls that were active,
+// outermost first.
+type RuntimeError struct {
+	Pos    token.Pos
+	Kind   string
+	Msg    string
+	Frames []Frame
+	Err    error
+}
+
+func (err *RuntimeError) Error() string {
+	if !err.Pos.IsValid() {
+		return err.Msg
+	}
+	return fmt.Sprintf("%v: %v", err.Pos, err.Msg)
+}
+
+func (err *RuntimeError) Position() token.Pos {
+	return err.Pos
+}
+
+func (err *RuntimeError) Unwrap() error {
+	return err.Err
+}
+
+// Traceback formats the call stack, most recent call last.
+func (err *RuntimeError) Traceback() string {
+	return traceback(err.Frames)
+}
+
+// ThrowError is a value thrown by a script with throw and not caught.
+type ThrowError struct {
+	Pos    token.Pos
+	Value  interface{}
+	Frames []Frame
+}
+
+func (err *ThrowError) Error() string {
+	msg := fmt.Sprintf("runtime error. uncaught throw of %v", printer.Repr(err.Value))
+	if !err.Pos.IsValid() {
+		return msg
+	}
+	return fmt.Sprintf("%v: %v", err.Pos, msg)
+}
+
+func (err *ThrowError) Position() token.Pos {
+	return err.Pos
+}
+
+// Traceback formats the call stack at the throw, most recent call last.
+func (err *ThrowError) Traceback() string {
+	return traceback(err.Frames)
+}
+
+// traceback lists the frames, collapsing a run of identical frames, such as
+// those left by deep recursion, into one line and a count of the rest.
+func traceback(frames []Frame) string {
+	var b strings.Builder
+	b.WriteString("Traceback (most recent call last):\n")
+	for i := 0; i < len(frames); {
+		fmt.Fprintf(&b, "  %v\n", frames[i])
+		n := 1
+		for i+n < len(frames) && frames[i+n] == frames[i] {
+			n++
+		}
+		if n == 2 {
+			b.WriteString("  ... repeated 1 more time\n")
+		} else if n > 2 {
+			fmt.Fprintf(&b, "  ... repeated %d more times\n", n-1)
+		}
+		i += n
+	}
+	return b.String()
+}
+
+// runtimeError converts err to a *RuntimeError carrying the current call
+// stack. Errors that already have a position keep it, so the innermost
+// location of a failure is the one reported. Control flow signals and
+// thrown values pass through untouched.
+func (interpreter *Interpreter) runtimeError(err error, pos token.Pos) error {
+	if _, ok := err.(signal); ok {
+		return err
+	}
+	var rerr *RuntimeError
+	var thrown *ThrowError
+	if errors.As(err, &rerr) || errors.As(err, &thrown) {
+		return err
+	}
+	msg := err.Error()
+	var terr *token.Error
+	if errors.As(err, &terr) {
+		pos = terr.Pos
+		msg = terr.Msg
+	}
+	kind := "error"
+	var berr *builtin.Error
+	var stop *stopError
+	if errors.As(err, &berr) {
+		kind = berr.Kind
+	} else if errors.As(err, &stop) {
+		kind = stop.kind
+	}
+	return &RuntimeError{Pos: pos, Kind: kind, Msg: msg, Frames: interpreter.frames(), Err: err}
+}
+
+func (interpreter *Interpreter) frames() []Frame {
+	frames := make([]Frame, len(interpreter.stack))
+	copy(frames, interpreter.stack)
+	return frames
+}
@@ -1,69 +1,336 @@
 package interpreter
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"reflect"
 	"strings"
 
 	"github.com/danwhitford/danlisp/internal/callable"
+	"github.com/danwhitford/danlisp/internal/environment"
 	"github.com/danwhitford/danlisp/internal/expr"
+	"github.com/danwhitford/danlisp/internal/number"
+	"github.com/danwhitford/danlisp/internal/stdlib/builtin"
 	"github.com/danwhitford/danlisp/internal/stdlib/danreflect"
 	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
 	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/list"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/symbol"
+	"github.com/danwhitford/danlisp/internal/stdlib/text"
 	"github.com/danwhitford/danlisp/internal/stdlib/wrappers"
+	"github.com/danwhitford/danlisp/internal/token"
 )
 
 type Interpreter struct {
-	environment map[string]interface{}
+	// Stdout, Stderr and Stdin are the streams used by prn, print, eprn,
+	// read-line and read-all.
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+	// Limits bounds the work done by each call to Interpret.
+	Limits Limits
+
+	environment *environment.Environment
+	stack       []Frame
+	// expanding counts the expansions being evaluated, which nest in the
+	// Go stack like calls do and so count towards the depth limit.
+	expanding   int
+	stdin       *bufio.Reader
+	stdinSource io.Reader
+
+	ctx   context.Context
+	done  <-chan struct{}
+	steps int
+	cells int
 }
 
 func NewInterpreter() Interpreter {
-	return Interpreter{NewEnvironment()}
+	return Interpreter{
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+		Stdin:       os.Stdin,
+		Limits:      Limits{Depth: DefaultDepth},
+		environment: NewEnvironment(),
+	}
 }
 
+// Interpret evaluates each expression in turn and returns the value of the
+// last one. A panic during evaluation is returned as an error rather than
+// crashing the host program.
 func (interpreter *Interpreter) Interpret(exprs []expr.Expr) (interface{}, error) {
-	var retval interface{}
-	var err error
+	return interpreter.InterpretContext(context.Background(), exprs)
+}
+
+// InterpretContext is like Interpret but stops with an error wrapping
+// ctx.Err() once ctx is done, and with one wrapping ErrLimitExceeded if
+// the program goes over the interpreter's Limits. Neither error can be
+// caught by the program.
+func (interpreter *Interpreter) InterpretContext(ctx context.Context, exprs []expr.Expr) (retval interface{}, err error) {
+	interpreter.start(ctx)
+	defer func() {
+		if r := recover(); r != nil {
+			retval = nil
+			err = &RuntimeError{Kind: "error", Msg: fmt.Sprintf("runtime error. %v", r)}
+		}
+	}()
 	for _, ex := range exprs {
 		retval, err = interpreter.eval(ex)
 		if err != nil {
-			return nil, err
+			return nil, interpreter.uncaught(err)
 		}
 	}
 	return retval, nil
 }
 
-func (interpreter *Interpreter) eval(ex expr.Expr) (interface{}, error) {
+// Apply calls a function value with arguments that have already been
+// evaluated, as if from the top level of a program.
+func (interpreter *Interpreter) Apply(fn interface{}, args []interface{}) (interface{}, error) {
+	return interpreter.ApplyContext(context.Background(), fn, args)
+}
 
-	switch v := ex.(type) {
-	case expr.Atom:
-		return evalAtom(v), nil
-	case expr.Seq:
-		return interpreter.evalSeq(v)
-	case expr.Symbol:
-		return interpreter.evalSymbol(v)
-	case expr.Set:
-		return interpreter.evalSet(v)
-	case expr.If:
-		return interpreter.evalIf(v)
-	case expr.While:
-		return interpreter.evalWhile(v)
-	case expr.Defn:
-		return interpreter.evalDefun(v)
-	case expr.For:
-		return interpreter.evalFor(v)
+// ApplyContext is like Apply but stops once ctx is done, as
+// InterpretContext does.
+func (interpreter *Interpreter) ApplyContext(ctx context.Context, fn interface{}, args []interface{}) (retval interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			retval = nil
+			err = &RuntimeError{Kind: "error", Msg: fmt.Sprintf("runtime error. %v", r)}
+		}
+	}()
+	interpreter.start(ctx)
+	retval, err = interpreter.apply(fn, args, token.Pos{})
+	if err != nil {
+		return nil, interpreter.uncaught(interpreter.runtimeError(err, token.Pos{}))
 	}
+	return retval, nil
+}
+
+// Define binds a name in the global environment.
+func (interpreter *Interpreter) Define(name string, val interface{}) {
+	interpreter.globals().Define(name, val)
+}
+
+// Lookup returns the value of a global variable.
+func (interpreter *Interpreter) Lookup(name string) (interface{}, bool) {
+	return interpreter.globals().Get(name)
+}
 
-	return nil, fmt.Errorf("don't know how to eval this thing %v of type %T", ex, ex)
+// IsMacro reports whether a global variable is bound to a macro. Pass it to
+// Parser.KnownMacros when parsing more source for the interpreter.
+func (interpreter *Interpreter) IsMacro(name string) bool {
+	val, _ := interpreter.Lookup(name)
+	_, ok := val.(callable.Macro)
+	return ok
+}
+
+func (interpreter *Interpreter) globals() *environment.Environment {
+	env := interpreter.environment
+	for env.Parent() != nil {
+		env = env.Parent()
+	}
+	return env
+}
+
+// eval evaluates an expression. Expressions in tail position, the branches
+// of an if and the last expression of a function body, are evaluated by
+// looping rather than recursing so that tail calls run in constant Go stack.
+func (interpreter *Interpreter) eval(ex expr.Expr) (val interface{}, err error) {
+	caller := interpreter.environment
+	depth := len(interpreter.stack)
+	// Once a call has been entered the rest of the loop is evaluating its
+	// body, so a return lands here.
+	entered := false
+	expanded := false
+	defer func() {
+		if entered {
+			val, err = interpreter.leaveFunction(val, err)
+		}
+		if expanded {
+			interpreter.expanding--
+		}
+		interpreter.environment = caller
+		interpreter.stack = interpreter.stack[:depth]
+	}()
+
+	for {
+		if err := interpreter.tick(); err != nil {
+			return nil, interpreter.runtimeError(err, expr.PosOf(ex))
+		}
+		switch v := ex.(type) {
+		case expr.If:
+			branch, err := interpreter.evalIf(v)
+			if err != nil {
+				return nil, err
+			}
+			ex = branch
+			continue
+		case expr.Seq:
+			if len(v.Exprs) == 0 {
+				return nil, nil
+			}
+			if macro, ok := interpreter.lookupMacro(v); ok {
+				if !expanded {
+					if err := interpreter.checkDepth(depth); err != nil {
+						return nil, interpreter.runtimeError(err, v.Pos)
+					}
+					interpreter.expanding++
+					expanded = true
+				}
+				expansion, err := interpreter.expandSeq(macro, v)
+				if err != nil {
+					return nil, interpreter.runtimeError(err, v.Pos)
+				}
+				ex = expansion
+				continue
+			}
+			if v.Err != nil {
+				return nil, interpreter.runtimeError(v.Err, v.Pos)
+			}
+			fn, args, err := interpreter.evalSeqArgs(v)
+			if err != nil {
+				return nil, err
+			}
+			c, ok := fn.(callable.Callable)
+			if !ok {
+				val, err := interpreter.apply(fn, args, v.Pos)
+				if err != nil {
+					return nil, interpreter.runtimeError(err, v.Pos)
+				}
+				return val, nil
+			}
+			entered = true
+			tail, err := interpreter.enter(c, args, v.Pos, depth)
+			if err != nil {
+				return nil, interpreter.runtimeError(err, v.Pos)
+			}
+			ex = tail
+			continue
+		case expr.Let:
+			tail, err := interpreter.enterLet(v)
+			if err != nil {
+				return nil, err
+			}
+			ex = tail
+			continue
+		case expr.Cond:
+			tail, err := interpreter.evalCond(v)
+			if err != nil {
+				return nil, err
+			}
+			ex = tail
+			continue
+		case expr.When:
+			tail, err := interpreter.evalWhen(v.Cond, v.Body, true)
+			if err != nil {
+				return nil, err
+			}
+			ex = tail
+			continue
+		case expr.Unless:
+			tail, err := interpreter.evalWhen(v.Cond, v.Body, false)
+			if err != nil {
+				return nil, err
+			}
+			ex = tail
+			continue
+		case expr.Do:
+			tail, err := interpreter.evalBody(v.Body)
+			if err != nil {
+				return nil, err
+			}
+			ex = tail
+			continue
+		case expr.And:
+			tail, err := interpreter.evalLogic(v.Exprs, false, true)
+			if err != nil {
+				return nil, err
+			}
+			ex = tail
+			continue
+		case expr.Or:
+			tail, err := interpreter.evalLogic(v.Exprs, true, nil)
+			if err != nil {
+				return nil, err
+			}
+			ex = tail
+			continue
+		case expr.Return:
+			return interpreter.evalReturn(v)
+		case expr.Try:
+			return interpreter.evalTry(v)
+		case expr.Throw:
+			return interpreter.evalThrow(v)
+		case expr.Break:
+			return nil, &breakSignal{pos: v.Pos}
+		case expr.Continue:
+			return nil, &continueSignal{pos: v.Pos}
+		case expr.Atom:
+			return evalAtom(v), nil
+		case expr.Symbol:
+			return interpreter.evalSymbol(v)
+		case expr.Set:
+			return interpreter.evalSet(v)
+		case expr.While:
+			return interpreter.evalWhile(v)
+		case expr.Defn:
+			return interpreter.evalDefun(v)
+		case expr.Defmacro:
+			return interpreter.evalDefmacro(v)
+		case expr.For:
+			return interpreter.evalFor(v)
+		case expr.Fn:
+			return interpreter.evalFn(v), nil
+		case expr.Quote:
+			return v.Datum, nil
+		case expr.Quasiquote:
+			val, err := interpreter.evalTemplate(v.Template)
+			if err != nil {
+				return nil, interpreter.runtimeError(err, v.Pos)
+			}
+			return val, nil
+		}
+
+		return nil, fmt.Errorf("don't know how to eval this thing %v of type %T", ex, ex)
+	}
 }
 
 func (interpreter *Interpreter) evalDefun(ex expr.Defn) (interface{}, error) {
+	callable := interpreter.makeCallable(ex.Name.Name, ex.Arglist, ex.Body)
+	interpreter.environment.Define(ex.Name.Name, callable)
+	return nil, nil
+}
+
+func (interpreter *Interpreter) evalDefmacro(ex expr.Defmacro) (interface{}, error) {
+	macro := callable.Macro{Callable: interpreter.makeCallable(ex.Name.Name, ex.Arglist, ex.Body)}
+	interpreter.environment.Define(ex.Name.Name, macro)
+	return nil, nil
+}
+
+func (interpreter *Interpreter) evalFn(ex expr.Fn) interface{} {
+	return interpreter.makeCallable("", ex.Arglist, ex.Body)
+}
+
+func (interpreter *Interpreter) makeCallable(name string, args expr.Arglist, body []expr.Expr) callable.Callable {
 	arglist := []string{}
-	for _, a := range ex.Arglist {
+	for _, a := range args.Required {
 		arglist = append(arglist, a.Name)
 	}
-	callable := callable.Callable{Arity: len(arglist), Args: arglist, Body: ex.Body}
-	interpreter.environment[ex.Name.Name] = callable
-	return nil, nil
+	rest := ""
+	if args.Rest != nil {
+		rest = args.Rest.Name
+	}
+	return callable.Callable{
+		Name:     name,
+		Arity:    len(arglist),
+		Args:     arglist,
+		Optional: args.Optional,
+		Rest:     rest,
+		Body:     body,
+		Closure:  interpreter.environment,
+	}
 }
 
 func (interpreter *Interpreter) evalFor(ex expr.For) (interface{}, error) {
@@ -81,13 +348,14 @@ func (interpreter *Interpreter) evalFor(ex expr.For) (interface{}, error) {
 			break
 		}
 
-		for _, line := range ex.Body {
-			val, er := interpreter.eval(line)
-			if er != nil {
-				return nil, er
-			}
-			retval = val
+		val, brk, err := interpreter.evalLoopBody(ex.Body)
+		if err != nil {
+			return nil, err
 		}
+		if brk {
+			return nil, nil
+		}
+		retval = val
 
 		_, err = interpreter.eval(ex.Step)
 		if err != nil {
@@ -108,120 +376,546 @@ func (interpreter *Interpreter) evalWhile(ex expr.While) (interface{}, error) {
 		if !isTruthy(c) {
 			break
 		}
-		for _, line := range ex.Body {
-			val, er := interpreter.eval(line)
-			if er != nil {
-				return nil, er
-			}
-			retval = val
+		val, brk, err := interpreter.evalLoopBody(ex.Body)
+		if err != nil {
+			return nil, err
+		}
+		if brk {
+			return nil, nil
 		}
+		retval = val
 	}
 	return retval, nil
 }
 
+// evalLoopBody evaluates one iteration of a loop body and reports whether
+// it ended in a break. A continue ends the iteration early.
+func (interpreter *Interpreter) evalLoopBody(body []expr.Expr) (interface{}, bool, error) {
+	var retval interface{}
+	for _, line := range body {
+		val, err := interpreter.eval(line)
+		switch err.(type) {
+		case nil:
+			retval = val
+		case *breakSignal:
+			return nil, true, nil
+		case *continueSignal:
+			return retval, false, nil
+		default:
+			return nil, false, err
+		}
+	}
+	return retval, false, nil
+}
+
+func (interpreter *Interpreter) evalReturn(ex expr.Return) (interface{}, error) {
+	var val interface{}
+	if ex.Value != nil {
+		var err error
+		val, err = interpreter.eval(ex.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, &returnSignal{value: val, pos: ex.Pos}
+}
+
+// evalTemplate fills in the unquoted parts of a quasiquote template.
+func (interpreter *Interpreter) evalTemplate(template interface{}) (interface{}, error) {
+	switch v := template.(type) {
+	case expr.Unquote:
+		return interpreter.eval(v.Expr)
+	case expr.UnquoteSplicing:
+		return nil, interpreter.runtimeError(fmt.Errorf("runtime error. unquote-splicing must be inside a list"), v.Pos)
+	case cons.ConsCell:
+		cdr, err := interpreter.evalTemplate(v.Cdr)
+		if err != nil {
+			return nil, err
+		}
+		if splice, ok := v.Car.(expr.UnquoteSplicing); ok {
+			val, err := interpreter.eval(splice.Expr)
+			if err != nil {
+				return nil, err
+			}
+			items, ok := listToSlice(val)
+			if !ok {
+				err := builtin.Errorf(builtin.TypeError, "runtime error. unquote-splicing expects a list but got %v", builtin.TypeName(val))
+				return nil, interpreter.runtimeError(err, splice.Pos)
+			}
+			if err := interpreter.alloc(len(items)); err != nil {
+				return nil, interpreter.runtimeError(err, splice.Pos)
+			}
+			for i := len(items) - 1; i >= 0; i-- {
+				cdr = cons.Cons(items[i], cdr)
+			}
+			return cdr, nil
+		}
+		car, err := interpreter.evalTemplate(v.Car)
+		if err != nil {
+			return nil, err
+		}
+		if err := interpreter.alloc(1); err != nil {
+			return nil, err
+		}
+		return cons.Cons(car, cdr), nil
+	}
+	return template, nil
+}
+
+// listToSlice returns the elements of a proper list.
+func listToSlice(list interface{}) ([]interface{}, bool) {
+	items := []interface{}{}
+	for list != nil {
+		cell, ok := list.(cons.ConsCell)
+		if !ok {
+			return nil, false
+		}
+		items = append(items, cell.Car)
+		list = cell.Cdr
+	}
+	return items, true
+}
+
 func evalAtom(ex expr.Atom) interface{} {
 	return ex.Value
 }
 
 func (interpreter *Interpreter) evalSymbol(ex expr.Symbol) (interface{}, error) {
-	val, ok := interpreter.environment[ex.Name]
+	val, ok := interpreter.environment.Get(ex.Name)
 	if !ok {
-		return nil, fmt.Errorf("runtime error. Could not find symbol '%v'", ex.Name)
+		err := builtin.Errorf(builtin.UnboundSymbol, "runtime error. Could not find symbol '%v'", ex.Name)
+		return nil, interpreter.runtimeError(err, ex.Pos)
 	}
 	return val, nil
 }
 
-func (interpreter *Interpreter) evalSeq(ex expr.Seq) (interface{}, error) {
+// evalSeqArgs evaluates the head and arguments of a function call.
+func (interpreter *Interpreter) evalSeqArgs(ex expr.Seq) (interface{}, []interface{}, error) {
 	symbol, err := interpreter.eval(ex.Exprs[0])
 	if err != nil {
-		return symbol, err
+		return nil, nil, err
 	}
 	args := []interface{}{}
 	for _, argex := range ex.Exprs[1:] {
 		arg, err := interpreter.eval(argex)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		args = append(args, arg)
 	}
+	return symbol, args, nil
+}
+
+func (interpreter *Interpreter) apply(fn interface{}, args []interface{}, pos token.Pos) (interface{}, error) {
 	//TODO convert builtins to Callables
-	switch s := symbol.(type) {
+	switch s := fn.(type) {
 	case callable.Callable:
-		return interpreter.call(s, args)
+		return interpreter.call(s, args, pos)
 	case func([]interface{}) interface{}:
 		return s(args), nil
 	case func([]interface{}) (interface{}, error):
 		return s(args)
+	case func(*Interpreter, []interface{}) (interface{}, error):
+		return s(interpreter, args)
 	}
-	return nil, fmt.Errorf("did not know how to evaluate seq %v", ex)
+	return nil, builtin.Errorf(builtin.TypeError, "runtime error. %v is not a function", fn)
 }
 
 func (interpreter *Interpreter) evalSet(ex expr.Set) (interface{}, error) {
 	val, err := interpreter.eval(ex.Value)
-	interpreter.environment[ex.Var.Name] = val
-	return nil, err
+	if err != nil {
+		return nil, err
+	}
+	interpreter.environment.Set(ex.Var.Name, val)
+	return nil, nil
 }
 
-func (interpreter *Interpreter) evalIf(iff expr.If) (interface{}, error) {
+// enterLet binds the let's variables in a new frame, which becomes the
+// current environment, and returns the last expression of the body after
+// evaluating the rest.
+func (interpreter *Interpreter) enterLet(let expr.Let) (expr.Expr, error) {
+	frame := environment.NewEnvironment(interpreter.environment)
+	if let.Sequential {
+		interpreter.environment = frame
+	}
+	for _, b := range let.Bindings {
+		val, err := interpreter.eval(b.Value)
+		if err != nil {
+			return nil, err
+		}
+		frame.Define(b.Var.Name, val)
+	}
+	interpreter.environment = frame
+	return interpreter.evalBody(let.Body)
+}
+
+// evalAll evaluates a body and returns the value of its last expression.
+func (interpreter *Interpreter) evalAll(body []expr.Expr) (interface{}, error) {
+	tail, err := interpreter.evalBody(body)
+	if err != nil {
+		return nil, err
+	}
+	return interpreter.eval(tail)
+}
+
+// evalBody evaluates all but the last expression of a body and returns the
+// last for the caller to evaluate in tail position.
+func (interpreter *Interpreter) evalBody(body []expr.Expr) (expr.Expr, error) {
+	if len(body) == 0 {
+		return expr.Atom{}, nil
+	}
+	last := len(body) - 1
+	for _, e := range body[:last] {
+		if _, err := interpreter.eval(e); err != nil {
+			return nil, err
+		}
+	}
+	return body[last], nil
+}
+
+// evalIf evaluates the condition and returns the branch to be evaluated in
+// its place.
+func (interpreter *Interpreter) evalIf(iff expr.If) (expr.Expr, error) {
 	cond, err := interpreter.eval(iff.Cond)
 	if err != nil {
 		return nil, err
 	}
-	var expr expr.Expr
 	if isTruthy(cond) {
-		expr = iff.TrueBranch
-	} else {
-		expr = iff.FalseBranch
+		return iff.TrueBranch, nil
 	}
-	return interpreter.eval(expr)
+	if iff.FalseBranch == nil {
+		return expr.Atom{}, nil
+	}
+	return iff.FalseBranch, nil
 }
 
-func NewEnvironment() map[string]interface{} {
+// evalCond evaluates tests until one is truthy and returns the expression
+// to be evaluated in place of the cond.
+func (interpreter *Interpreter) evalCond(cond expr.Cond) (expr.Expr, error) {
+	for _, clause := range cond.Clauses {
+		if clause.Test == nil {
+			return interpreter.evalBody(clause.Body)
+		}
+		val, err := interpreter.eval(clause.Test)
+		if err != nil {
+			return nil, err
+		}
+		if !isTruthy(val) {
+			continue
+		}
+		if len(clause.Body) == 0 {
+			return expr.Atom{Value: val}, nil
+		}
+		return interpreter.evalBody(clause.Body)
+	}
+	return expr.Atom{}, nil
+}
+
+// evalWhen runs body if the truthiness of cond matches want, returning the
+// last expression of the body to evaluate in tail position.
+func (interpreter *Interpreter) evalWhen(cond expr.Expr, body []expr.Expr, want bool) (expr.Expr, error) {
+	val, err := interpreter.eval(cond)
+	if err != nil {
+		return nil, err
+	}
+	if isTruthy(val) != want {
+		return expr.Atom{}, nil
+	}
+	return interpreter.evalBody(body)
+}
+
+// evalLogic evaluates the operands of an and or or until one has the
+// truthiness given by stop, and returns an expression for that value. The
+// last operand is returned unevaluated to be evaluated in tail position.
+// With no operands the result is empty.
+func (interpreter *Interpreter) evalLogic(operands []expr.Expr, stop bool, empty interface{}) (expr.Expr, error) {
+	if len(operands) == 0 {
+		return expr.Atom{Value: empty}, nil
+	}
+	last := len(operands) - 1
+	for _, op := range operands[:last] {
+		val, err := interpreter.eval(op)
+		if err != nil {
+			return nil, err
+		}
+		if isTruthy(val) == stop {
+			return expr.Atom{Value: val}, nil
+		}
+	}
+	return operands[last], nil
+}
+
+// logicOp is the function version of and or or. Its arguments have already
+// been evaluated, but like the special form it returns the first whose
+// truth is stop, or the last.
+func logicOp(stop bool, empty interface{}) func([]interface{}) (interface{}, error) {
+	return func(argv []interface{}) (interface{}, error) {
+		val := empty
+		for _, val = range argv {
+			if isTruthy(val) == stop {
+				break
+			}
+		}
+		return val, nil
+	}
+}
+
+func NewEnvironment() *environment.Environment {
 	env := make(map[string]interface{})
 
 	// Built in vars
 	env["t"] = true
 
 	// Basic operators
-	env["+"] = func(argv []interface{}) interface{} { return argv[0].(float64) + argv[1].(float64) }
-	env["-"] = func(argv []interface{}) interface{} { return argv[0].(float64) - argv[1].(float64) }
-	env["*"] = func(argv []interface{}) interface{} { return argv[0].(float64) * argv[1].(float64) }
-	env["/"] = func(argv []interface{}) interface{} { return argv[0].(float64) / argv[1].(float64) }
-	env["mod"] = func(argv []interface{}) interface{} { return float64(int(argv[0].(float64)) % int(argv[1].(float64))) }
+	env["+"] = arithOp("+", int64(0), 0, exact(number.Add))
+	env["-"] = arithOp("-", int64(0), 1, exact(number.Sub))
+	env["*"] = arithOp("*", int64(1), 0, exact(number.Mul))
+	env["/"] = arithOp("/", int64(1), 1, number.Div)
+	env["mod"] = numberOp("mod", number.Mod)
 
 	// Bitwise ops
-	env["&"] = func(argv []interface{}) interface{} { return float64(int(argv[0].(float64)) & int(argv[1].(float64))) }
-	env["|"] = func(argv []interface{}) interface{} { return float64(int(argv[0].(float64)) | int(argv[1].(float64))) }
-	env["^"] = func(argv []interface{}) interface{} { return float64(int(argv[0].(float64)) ^ int(argv[1].(float64))) }
-	env["&^"] = func(argv []interface{}) interface{} { return float64(int(argv[0].(float64)) &^ int(argv[1].(float64))) }
-	env[">>"] = func(argv []interface{}) interface{} { return float64(int(argv[0].(float64)) >> int(argv[1].(float64))) }
-	env["<<"] = func(argv []interface{}) interface{} { return float64(int(argv[0].(float64)) << int(argv[1].(float64))) }
+	env["&"] = intOp("&", func(a, b *big.Int) (*big.Int, error) { return new(big.Int).And(a, b), nil })
+	env["|"] = intOp("|", func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Or(a, b), nil })
+	env["^"] = intOp("^", func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Xor(a, b), nil })
+	env["&^"] = intOp("&^", func(a, b *big.Int) (*big.Int, error) { return new(big.Int).AndNot(a, b), nil })
+	env[">>"] = intOp(">>", shift(func(a *big.Int, n uint) *big.Int { return new(big.Int).Rsh(a, n) }))
+	env["<<"] = intOp("<<", shift(func(a *big.Int, n uint) *big.Int { return new(big.Int).Lsh(a, n) }))
 
 	// Boleans
-	env["="] = func(argv []interface{}) interface{} { return argv[0] == argv[1] }
-	env["and"] = func(argv []interface{}) interface{} { return isTruthy(argv[0]) && isTruthy(argv[1]) }
-	env["or"] = func(argv []interface{}) interface{} { return isTruthy(argv[0]) || isTruthy(argv[1]) }
+	env["="] = equalOp("=", true)
+	env["!="] = equalOp("!=", false)
+	env["not="] = equalOp("not=", false)
+	env["not"] = func(argv []interface{}) (interface{}, error) {
+		if err := builtin.Arity("not", argv, 1); err != nil {
+			return nil, err
+		}
+		return !isTruthy(argv[0]), nil
+	}
+	// and and or are special forms at the head of a list, but these let
+	// them be passed around as functions.
+	env["and"] = logicOp(false, true)
+	env["or"] = logicOp(true, nil)
 
 	// Comparison
-	env["gt"] = func(argv []interface{}) interface{} { return argv[0].(float64) > argv[1].(float64) }
-	env["lt"] = func(argv []interface{}) interface{} { return argv[0].(float64) < argv[1].(float64) }
+	env["<"] = compareOp("<", func(c int) bool { return c < 0 })
+	env[">"] = compareOp(">", func(c int) bool { return c > 0 })
+	env["<="] = compareOp("<=", func(c int) bool { return c <= 0 })
+	env[">="] = compareOp(">=", func(c int) bool { return c >= 0 })
+	env["gt"] = compareOp("gt", func(c int) bool { return c > 0 })
+	env["lt"] = compareOp("lt", func(c int) bool { return c < 0 })
 
-	// Utility
-	env["prn"] = func(argv []interface{}) interface{} {
-		strs := []string{}
-		for _, v := range argv {
-			strs = append(strs, fmt.Sprintf("%v", v))
+	// Macros
+	env["macroexpand-1"] = macroexpand1
+	env["macroexpand"] = macroexpand
+	gensyms := 0
+	env["gensym"] = func(argv []interface{}) (interface{}, error) {
+		prefix := "G__"
+		if len(argv) > 0 {
+			p, err := builtin.String("gensym", argv, 0)
+			if err != nil {
+				return nil, err
+			}
+			prefix = p
 		}
-		fmt.Println(strings.Join(strs, " "))
-		return nil
+		gensyms++
+		return symbol.Symbol{Name: fmt.Sprintf("%v%d", prefix, gensyms)}, nil
 	}
 
-	cons.Register(env)
-	stringswrapper.Register(env)
+	// Input and output
+	env["prn"] = writer("prn", stdout, "\n")
+	env["print"] = writer("print", stdout, "")
+	env["eprn"] = writer("eprn", stderr, "\n")
+	env["read-line"] = readLine
+	env["read-all"] = readAll
+
+	registerErrorValues(env)
 	danreflect.Register(env)
 	list.Register(env)
+	text.Register(env)
 
-	return env
+	// Builtins that build lists count the cells they allocate.
+	env["cons"] = allocates(env["cons"].(func([]interface{}) (interface{}, error)), func([]interface{}, interface{}) int { return 1 })
+	env["list"] = allocates(env["list"].(func([]interface{}) (interface{}, error)), func(argv []interface{}, _ interface{}) int { return len(argv) })
+	generated := map[string]interface{}{}
+	wrappers.Register(generated)
+	for name, fn := range generated {
+		env[name] = allocates(fn.(func([]interface{}) (interface{}, error)), countCells)
+	}
+
+	return environment.NewGlobalEnvironment(env)
+}
+
+func numberOp(name string, op func(a, b interface{}) (interface{}, error)) func([]interface{}) (interface{}, error) {
+	return func(argv []interface{}) (interface{}, error) {
+		a, b, err := numberArgs(name, argv)
+		if err != nil {
+			return nil, err
+		}
+		res, err := op(a, b)
+		if err == number.ErrDivideByZero {
+			return nil, builtin.Errorf(builtin.ValueError, "runtime error. '%v' by zero", name)
+		}
+		return res, err
+	}
+}
+
+// exact adapts an operation that cannot fail for numberOp.
+func exact(op func(a, b interface{}) interface{}) func(a, b interface{}) (interface{}, error) {
+	return func(a, b interface{}) (interface{}, error) {
+		return op(a, b), nil
+	}
+}
+
+// arithOp folds op over its arguments from left to right. With a single
+// argument the fold starts from identity, so (- x) negates x, and with no
+// arguments the result is identity.
+func arithOp(name string, identity interface{}, min int, op func(a, b interface{}) (interface{}, error)) func([]interface{}) (interface{}, error) {
+	return func(argv []interface{}) (interface{}, error) {
+		if err := builtin.MinArity(name, argv, min); err != nil {
+			return nil, err
+		}
+		for i := range argv {
+			if _, err := builtin.Number(name, argv, i); err != nil {
+				return nil, err
+			}
+		}
+		acc, rest := identity, argv
+		if len(argv) > 1 {
+			acc, rest = argv[0], argv[1:]
+		}
+		for _, n := range rest {
+			var err error
+			acc, err = op(acc, n)
+			if err == number.ErrDivideByZero {
+				return nil, builtin.Errorf(builtin.ValueError, "runtime error. '%v' by zero", name)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return acc, nil
+	}
+}
+
+// compareOp builds a chained comparison, true when op holds for each pair
+// of neighbouring arguments. The arguments must be all numbers or all
+// strings. Comparisons involving NaN are always false.
+func compareOp(name string, op func(c int) bool) func([]interface{}) (interface{}, error) {
+	return func(argv []interface{}) (interface{}, error) {
+		if err := builtin.MinArity(name, argv, 1); err != nil {
+			return nil, err
+		}
+		check := builtin.Number
+		if _, ok := argv[0].(string); ok {
+			check = func(name string, argv []interface{}, i int) (interface{}, error) {
+				return builtin.String(name, argv, i)
+			}
+		}
+		for i := range argv {
+			if _, err := check(name, argv, i); err != nil {
+				return nil, err
+			}
+		}
+		result := true
+		for i := 1; i < len(argv); i++ {
+			c, ok := compare(argv[i-1], argv[i])
+			result = result && ok && op(c)
+		}
+		return result, nil
+	}
+}
+
+func compare(a, b interface{}) (int, bool) {
+	if s, ok := a.(string); ok {
+		return strings.Compare(s, b.(string)), true
+	}
+	return number.Compare(a, b)
+}
+
+// equalOp builds a chained equality test. When want is false it is the
+// negation, true unless all the arguments are equal.
+func equalOp(name string, want bool) func([]interface{}) (interface{}, error) {
+	return func(argv []interface{}) (interface{}, error) {
+		if err := builtin.MinArity(name, argv, 1); err != nil {
+			return nil, err
+		}
+		equal := true
+		for i := 1; i < len(argv); i++ {
+			equal = equal && isEqual(argv[i-1], argv[i])
+		}
+		return equal == want, nil
+	}
+}
+
+func intOp(name string, op func(a, b *big.Int) (*big.Int, error)) func([]interface{}) (interface{}, error) {
+	return func(argv []interface{}) (interface{}, error) {
+		if err := builtin.Arity(name, argv, 2); err != nil {
+			return nil, err
+		}
+		a, err := builtin.Integer(name, argv, 0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := builtin.Integer(name, argv, 1)
+		if err != nil {
+			return nil, err
+		}
+		res, err := op(number.ToBig(a), number.ToBig(b))
+		if err != nil {
+			return nil, err
+		}
+		return number.Normalize(res), nil
+	}
+}
+
+func shift(op func(a *big.Int, n uint) *big.Int) func(a, b *big.Int) (*big.Int, error) {
+	return func(a, b *big.Int) (*big.Int, error) {
+		if b.Sign() < 0 {
+			return nil, builtin.Errorf(builtin.ValueError, "runtime error. negative shift amount %v", b)
+		}
+		if !b.IsInt64() || b.Int64() > maxShift {
+			return nil, builtin.Errorf(builtin.ValueError, "runtime error. shift amount %v is too large", b)
+		}
+		return op(a, uint(b.Int64())), nil
+	}
+}
+
+// maxShift bounds shifts so a typo can't allocate gigabytes.
+const maxShift = 1 << 16
+
+func numberArgs(name string, argv []interface{}) (interface{}, interface{}, error) {
+	if err := builtin.Arity(name, argv, 2); err != nil {
+		return nil, nil, err
+	}
+	a, err := builtin.Number(name, argv, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := builtin.Number(name, argv, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, b, nil
+}
+
+// isEqual compares values without panicking on uncomparable types such as
+// functions.
+func isEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if number.IsNumber(a) && number.IsNumber(b) {
+		return number.Equal(a, b)
+	}
+	if ca, ok := a.(cons.ConsCell); ok {
+		cb, ok := b.(cons.ConsCell)
+		return ok && isEqual(ca.Car, cb.Car) && isEqual(ca.Cdr, cb.Cdr)
+	}
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta != tb || !ta.Comparable() {
+		return false
+	}
+	return a == b
 }
 
 func isTruthy(v interface{}) bool {
@@ -231,18 +925,91 @@ func isTruthy(v interface{}) bool {
 	return v != nil
 }
 
-// TODO check arity and stuff
-func (context *Interpreter) call(callable callable.Callable, argv []interface{}) (interface{}, error) {
-	for i, a := range argv {
-		context.environment[callable.Args[i]] = a
+func (context *Interpreter) call(callable callable.Callable, argv []interface{}, pos token.Pos) (interface{}, error) {
+	caller := context.environment
+	depth := len(context.stack)
+	defer func() {
+		context.environment = caller
+		context.stack = context.stack[:depth]
+	}()
+
+	tail, err := context.enter(callable, argv, pos, depth)
+	if err != nil {
+		return context.leaveFunction(nil, err)
 	}
-	var retval interface{}
-	var err error
-	for _, e := range callable.Body {
-		retval, err = context.eval(e)
-		if err != nil {
-			return nil, err
+	return context.leaveFunction(context.eval(tail))
+}
+
+// enter binds the arguments of a call in a new frame, which becomes the
+// current environment, and evaluates all but the last expression of the
+// body. The last expression is returned for the caller to evaluate so that
+// calls in tail position do not grow the Go stack. The call replaces any
+// frames above depth on the call stack.
+func (context *Interpreter) enter(callable callable.Callable, argv []interface{}, pos token.Pos, depth int) (expr.Expr, error) {
+	if err := checkArity(callable, len(argv)); err != nil {
+		return nil, err
+	}
+	if err := context.checkDepth(depth); err != nil {
+		return nil, err
+	}
+
+	frame := environment.NewEnvironment(callable.Closure)
+	context.environment = frame
+	context.stack = append(context.stack[:depth], Frame{Name: callable.Name, Pos: pos})
+
+	for i, name := range callable.Args {
+		frame.Define(name, argv[i])
+	}
+	// Defaults are evaluated in the new frame so they can refer to earlier
+	// parameters.
+	for i, opt := range callable.Optional {
+		n := callable.Arity + i
+		if n < len(argv) {
+			frame.Define(opt.Var.Name, argv[n])
+			continue
+		}
+		var val interface{}
+		if opt.Default != nil {
+			var err error
+			val, err = context.eval(opt.Default)
+			if err != nil {
+				return nil, err
+			}
 		}
+		frame.Define(opt.Var.Name, val)
+	}
+	if callable.Variadic() {
+		var rest interface{}
+		if fixed := callable.Arity + len(callable.Optional); fixed < len(argv) {
+			if err := context.alloc(len(argv) - fixed); err != nil {
+				return nil, err
+			}
+			rest = cons.FromSlice(argv[fixed:])
+		}
+		frame.Define(callable.Rest, rest)
+	}
+
+	return context.evalBody(callable.Body)
+}
+
+func checkArity(callable callable.Callable, argc int) error {
+	name := callable.Name
+	if name == "" {
+		name = "anonymous function"
+	} else {
+		name = fmt.Sprintf("function '%v'", name)
+	}
+
+	most := callable.MaxArity()
+	if argc >= callable.Arity && (most < 0 || argc <= most) {
+		return nil
+	}
+	switch {
+	case most < 0:
+		return builtin.Errorf(builtin.ArityError, "runtime error. %v expects at least %v but got %d", name, builtin.Arguments(callable.Arity), argc)
+	case most == callable.Arity:
+		return builtin.Errorf(builtin.ArityError, "runtime error. %v expects %v but got %d", name, builtin.Arguments(callable.Arity), argc)
+	default:
+		return builtin.Errorf(builtin.ArityError, "runtime error. %v expects %d to %d arguments but got %d", name, callable.Arity, most, argc)
 	}
-	return retval, nil
 }
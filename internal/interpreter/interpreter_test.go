@@ -1,12 +1,19 @@
 package interpreter
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/danwhitford/danlisp/internal/expr"
 	"github.com/danwhitford/danlisp/internal/lexer"
+	"github.com/danwhitford/danlisp/internal/number"
 	"github.com/danwhitford/danlisp/internal/parser"
 	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/symbol"
 )
 
 func assertString(t *testing.T, expected, actual string) {
@@ -15,8 +22,8 @@ func assertString(t *testing.T, expected, actual string) {
 	}
 }
 
-func assertNumber(t *testing.T, expected, actual float64) {
-	if expected != actual {
+func assertNumber(t *testing.T, expected float64, actual interface{}) {
+	if !number.Equal(expected, actual) {
 		t.Fatalf("Assertion failed. Expected '%v' but got '%v'", expected, actual)
 	}
 }
@@ -49,7 +56,7 @@ func TestJustNumber(t *testing.T) {
 	exprs := getExpressions("101")
 	intr := NewInterpreter()
 	ret, _ := intr.Interpret(exprs)
-	assertNumber(t, 101, ret.(float64))
+	assertNumber(t, 101, ret)
 }
 
 func TestJustString(t *testing.T) {
@@ -63,73 +70,73 @@ func TestAddTwo(t *testing.T) {
 	exprs := getExpressions("(+ 2 7)")
 	intr := NewInterpreter()
 	ret, _ := intr.Interpret(exprs)
-	assertNumber(t, 9, ret.(float64))
+	assertNumber(t, 9, ret)
 }
 
 func TestSubtract(t *testing.T) {
 	exprs := getExpressions("(- 2 7)")
 	intr := NewInterpreter()
 	ret, _ := intr.Interpret(exprs)
-	assertNumber(t, -5, ret.(float64))
+	assertNumber(t, -5, ret)
 }
 
 func TestErrorFuncNotFound(t *testing.T) {
 	exprs := getExpressions("(nonsuch 2 7)")
 	intr := NewInterpreter()
 	_, err := intr.Interpret(exprs)
-	assertString(t, "runtime error. Could not find symbol 'nonsuch'", err.Error())
+	assertString(t, "1:2: runtime error. Could not find symbol 'nonsuch'", err.Error())
 }
 
 func TestMoreBasicOperators(t *testing.T) {
 	exprs := getExpressions("(* 2 7)")
 	intr := NewInterpreter()
 	ret, _ := intr.Interpret(exprs)
-	assertNumber(t, 14, ret.(float64))
+	assertNumber(t, 14, ret)
 
 	exprs = getExpressions("(/ 10 4)")
 	ret, _ = intr.Interpret(exprs)
-	assertNumber(t, 2.5, ret.(float64))
+	assertNumber(t, 2.5, ret)
 
 	exprs = getExpressions("(mod 10 4)")
 	ret, _ = intr.Interpret(exprs)
-	assertNumber(t, 2, ret.(float64))
+	assertNumber(t, 2, ret)
 }
 
 func TestBitwiseOps(t *testing.T) {
 	exprs := getExpressions("(& 255 101)")
 	intr := NewInterpreter()
 	ret, _ := intr.Interpret(exprs)
-	assertNumber(t, 101, ret.(float64))
+	assertNumber(t, 101, ret)
 
 	exprs = getExpressions("(| 255 72)")
 	ret, _ = intr.Interpret(exprs)
-	assertNumber(t, 255, ret.(float64))
+	assertNumber(t, 255, ret)
 
 	exprs = getExpressions("(^ 0 72)")
 	ret, _ = intr.Interpret(exprs)
-	assertNumber(t, 72, ret.(float64))
+	assertNumber(t, 72, ret)
 
 	exprs = getExpressions("(&^ 255 72)")
 	ret, _ = intr.Interpret(exprs)
-	assertNumber(t, 183, ret.(float64))
+	assertNumber(t, 183, ret)
 }
 
 func TestShifts(t *testing.T) {
 	exprs := getExpressions("(>> 255 2)")
 	intr := NewInterpreter()
 	ret, _ := intr.Interpret(exprs)
-	assertNumber(t, 63, ret.(float64))
+	assertNumber(t, 63, ret)
 
 	exprs = getExpressions("(<< 255 2)")
 	ret, _ = intr.Interpret(exprs)
-	assertNumber(t, 1020, ret.(float64))
+	assertNumber(t, 1020, ret)
 }
 
 func TestDefinition(t *testing.T) {
 	exprs := getExpressions("(set foo 10) (* foo 5)")
 	intr := NewInterpreter()
 	ret, _ := intr.Interpret(exprs)
-	assertNumber(t, 50, ret.(float64))
+	assertNumber(t, 50, ret)
 }
 
 func TestEquals(t *testing.T) {
@@ -185,7 +192,7 @@ func TestWhileExpr(t *testing.T) {
 	exprs := getExpressions(`(set x 5) (set total 0) (while (gt x 0) (set total (+ total x)) (set x (- x 1))) total`)
 	intr := NewInterpreter()
 	ret, _ := intr.Interpret(exprs)
-	assertNumber(t, 15, ret.(float64))
+	assertNumber(t, 15, ret)
 }
 
 func TestNestedError(t *testing.T) {
@@ -195,7 +202,7 @@ func TestNestedError(t *testing.T) {
 	if err == nil {
 		t.Fatal("Expecting error")
 	}
-	assertString(t, "runtime error. Could not find symbol 'foo'", err.Error())
+	assertString(t, "1:6: runtime error. Could not find symbol 'foo'", err.Error())
 }
 
 func TestNestedErrorWhile(t *testing.T) {
@@ -205,7 +212,7 @@ func TestNestedErrorWhile(t *testing.T) {
 	if err == nil {
 		t.Fatal("Expecting error")
 	}
-	assertString(t, "runtime error. Could not find symbol 'foo'", err.Error())
+	assertString(t, "1:9: runtime error. Could not find symbol 'foo'", err.Error())
 }
 
 func TestAdderFunc(t *testing.T) {
@@ -215,7 +222,7 @@ func TestAdderFunc(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Not expecting error but got %v", err)
 	}
-	assertNumber(t, 5, ret.(float64))
+	assertNumber(t, 5, ret)
 }
 
 func TestNilIsFalse(t *testing.T) {
@@ -225,7 +232,7 @@ func TestNilIsFalse(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Not expecting error but got %v", err)
 	}
-	assertNumber(t, 0, ret.(float64))
+	assertNumber(t, 0, ret)
 }
 
 func TestCreateCons(t *testing.T) {
@@ -235,7 +242,7 @@ func TestCreateCons(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Not expecting error but got %v", err)
 	}
-	assertNumber(t, 1, ret.(cons.ConsCell).Car.(float64))
+	assertNumber(t, 1, ret.(cons.ConsCell).Car)
 	if ret.(cons.ConsCell).Cdr != nil {
 		t.Fatalf("Expecting nil but got %v", ret.(cons.ConsCell).Cdr)
 	}
@@ -251,7 +258,7 @@ func TestCar(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Not expecting error but got %v", err)
 	}
-	assertNumber(t, 1, ret.(float64))
+	assertNumber(t, 1, ret)
 }
 
 func TestCdr(t *testing.T) {
@@ -264,7 +271,7 @@ func TestCdr(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Not expecting error but got %v", err)
 	}
-	assertNumber(t, 2, ret.(cons.ConsCell).Car.(float64))
+	assertNumber(t, 2, ret.(cons.ConsCell).Car)
 }
 
 func TestListFunc(t *testing.T) {
@@ -276,9 +283,9 @@ func TestListFunc(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Not expecting error but got %v", err)
 	}
-	assertNumber(t, 1, ret.(cons.ConsCell).Car.(float64))
-	assertNumber(t, 2, ret.(cons.ConsCell).Cdr.(cons.ConsCell).Car.(float64))
-	assertNumber(t, 3, ret.(cons.ConsCell).Cdr.(cons.ConsCell).Cdr.(cons.ConsCell).Car.(float64))
+	assertNumber(t, 1, ret.(cons.ConsCell).Car)
+	assertNumber(t, 2, ret.(cons.ConsCell).Cdr.(cons.ConsCell).Car)
+	assertNumber(t, 3, ret.(cons.ConsCell).Cdr.(cons.ConsCell).Cdr.(cons.ConsCell).Car)
 }
 
 func TestCarNil(t *testing.T) {
@@ -309,8 +316,8 @@ func TestCdrNil(t *testing.T) {
 
 func TestPrintType(t *testing.T) {
 	intr := NewInterpreter()
-	sources := []string{"(set i 5) (type i)", `(set s "foo") (type s)`, "(set l (list 1 2 3)) (type l)"}
-	expected := []string{"float64", "string", "cons.ConsCell"}
+	sources := []string{"(set i 5) (type i)", `(set s "foo") (type s)`, "(set l (list 1 2 3)) (type l)", "(type 1/2)", "(type 'a)", "(type car)", "(defmacro m () 1) (type m)"}
+	expected := []string{"integer", "string", "list", "rational", "symbol", "function", "macro"}
 
 	for i, s := range sources {
 		exprs := getExpressions(s)
@@ -335,5 +342,1117 @@ func TestForLoop(t *testing.T) {
 	(for (set i 0) (lt i 10) (set i (+ i 1))
 		(set total (+ total i)))
 	total`)
-	assertNumber(t, 45, ret.(float64))
+	assertNumber(t, 45, ret)
+}
+
+func TestArgsDoNotClobberGlobals(t *testing.T) {
+	ret := run(t, `
+	(set i 100)
+	(defn double (i) (* i 2))
+	(double 4)
+	i`)
+	assertNumber(t, 100, ret)
+}
+
+func TestRecursionKeepsCallerArgs(t *testing.T) {
+	ret := run(t, `
+	(defn fact (n)
+		(if (lt n 2)
+			1
+			(* n (fact (- n 1)))))
+	(fact 5)`)
+	assertNumber(t, 120, ret)
+}
+
+func TestSetResolvesNearestBinding(t *testing.T) {
+	ret := run(t, `
+	(set count 0)
+	(defn incr () (set count (+ count 1)))
+	(incr)
+	(incr)
+	count`)
+	assertNumber(t, 2, ret)
+}
+
+func TestFailedSetKeepsValue(t *testing.T) {
+	ret := run(t, `
+	(set x 1)
+	(try (set x (throw 5)) (catch e x))`)
+	assertNumber(t, 1, ret)
+
+	ret = run(t, `
+	(set x 1)
+	(try (set x (car 5)) (catch e x))`)
+	assertNumber(t, 1, ret)
+}
+
+func TestClosureCapturesDefiningEnvironment(t *testing.T) {
+	ret := run(t, `
+	(defn outer (x)
+		(defn inner (y) (+ x y))
+		inner)
+	(set add5 (outer 5))
+	(set x 1000)
+	(add5 2)`)
+	assertNumber(t, 7, ret)
+}
+
+func TestAnonymousFn(t *testing.T) {
+	ret := run(t, `((fn (a b) (+ a b)) 2 3)`)
+	assertNumber(t, 5, ret)
+
+	ret = run(t, `(set sq (lambda (x) (* x x))) (sq 9)`)
+	assertNumber(t, 81, ret)
+}
+
+func TestHigherOrderFns(t *testing.T) {
+	ret := run(t, `
+	(defn map (f l)
+		(if l
+			(cons (f (car l)) (map f (cdr l)))
+			nil))
+	(defn reduce (f acc l)
+		(if l
+			(reduce f (f acc (car l)) (cdr l))
+			acc))
+	(reduce (fn (a b) (+ a b)) 0 (map (fn (x) (* x 10)) (list 1 2 3)))`)
+	assertNumber(t, 60, ret)
+}
+
+func TestFnReturnedFromFn(t *testing.T) {
+	ret := run(t, `
+	(defn make-counter ()
+		(set n 0)
+		(fn () (set n (+ n 1)) n))
+	(set c (make-counter))
+	(set other (make-counter))
+	(c)
+	(c)
+	(other)
+	(c)`)
+	assertNumber(t, 3, ret)
+}
+
+func TestArityTooMany(t *testing.T) {
+	exprs := getExpressions("(defn adder (a b) (+ a b)) (adder 1 2 3)")
+	intr := NewInterpreter()
+	_, err := intr.Interpret(exprs)
+	if err == nil {
+		t.Fatal("Expecting error")
+	}
+	assertString(t, "1:28: runtime error. function 'adder' expects 2 arguments but got 3", err.Error())
+}
+
+func TestArityTooFew(t *testing.T) {
+	exprs := getExpressions("(set b 100) (defn adder (a b) (+ a b)) (adder 1)")
+	intr := NewInterpreter()
+	_, err := intr.Interpret(exprs)
+	if err == nil {
+		t.Fatal("Expecting error")
+	}
+	assertString(t, "1:40: runtime error. function 'adder' expects 2 arguments but got 1", err.Error())
+
+	_, err = intr.Interpret(getExpressions("(defn inc (a) (+ a 1)) (inc)"))
+	assertString(t, "1:24: runtime error. function 'inc' expects 1 argument but got 0", err.Error())
+	_, err = intr.Interpret(getExpressions("(defn f (a &rest more) a) (f)"))
+	assertString(t, "1:27: runtime error. function 'f' expects at least 1 argument but got 0", err.Error())
+}
+
+func TestOptionalArgs(t *testing.T) {
+	ret := run(t, `
+	(defn scale (x &optional (factor 10) (offset factor))
+		(+ (* x factor) offset))
+	(list (scale 2) (scale 2 3) (scale 2 3 1))`)
+	l := ret.(cons.ConsCell)
+	assertNumber(t, 30, l.Car)
+	assertNumber(t, 9, l.Cdr.(cons.ConsCell).Car)
+	assertNumber(t, 7, l.Cdr.(cons.ConsCell).Cdr.(cons.ConsCell).Car)
+
+	exprs := getExpressions("(defn f (a &optional b) a) (f 1 2 3)")
+	intr := NewInterpreter()
+	_, err := intr.Interpret(exprs)
+	assertString(t, "1:28: runtime error. function 'f' expects 1 to 2 arguments but got 3", err.Error())
+}
+
+func TestRestArgs(t *testing.T) {
+	ret := run(t, `
+	(defn sum (&rest nums)
+		(set total 0)
+		(while nums
+			(set total (+ total (car nums)))
+			(set nums (cdr nums)))
+		total)
+	(sum 1 2 3 4)`)
+	assertNumber(t, 10, ret)
+
+	ret = run(t, `((fn (a &rest more) more) 1)`)
+	if ret != nil {
+		t.Fatalf("Expected nil but got %v", ret)
+	}
+
+	exprs := getExpressions("((fn (a b &rest more) a) 1)")
+	intr := NewInterpreter()
+	_, err := intr.Interpret(exprs)
+	assertString(t, "1:1: runtime error. anonymous function expects at least 2 arguments but got 1", err.Error())
+}
+
+func TestBuiltinTypeErrors(t *testing.T) {
+	sources := []string{`(+ "a" 1)`, `(-)`, `(gt 1 nil)`, `(& 7.5 2)`, `(mod 1 0)`, `(car 1 2)`, `(nth (list 1 2) 5)`, `(strings/Contains 1 "a")`, `(+ cons 1)`, `(+ 1 prn)`}
+	expected := []string{
+		"runtime error. '+' expects a number as argument 1 but got string",
+		"runtime error. '-' expects at least 1 argument but got 0",
+		"runtime error. 'gt' expects a number as argument 2 but got nil",
+		"runtime error. '&' expects an integer as argument 1 but got float",
+		"runtime error. 'mod' by zero",
+		"runtime error. 'car' expects 1 argument but got 2",
+		"runtime error. 'nth' index out of range",
+		"runtime error. 'strings/Contains' expects a string as argument 1 but got integer",
+		"runtime error. '+' expects a number as argument 1 but got function",
+		"runtime error. '+' expects a number as argument 2 but got function",
+	}
+
+	for i, s := range sources {
+		intr := NewInterpreter()
+		_, err := intr.Interpret(getExpressions(s))
+		if err == nil {
+			t.Fatalf("Expecting error for %v", s)
+		}
+		assertString(t, "1:1: "+expected[i], err.Error())
+	}
+}
+
+func TestEqualsOnFunctionsDoesNotPanic(t *testing.T) {
+	ret := run(t, `(defn f () 1) (= (list f) (list f))`)
+	assert(t, !ret.(bool))
+}
+
+func TestRecoverFromPanic(t *testing.T) {
+	intr := NewInterpreter()
+	intr.environment.Define("boom", func(argv []interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	_, err := intr.Interpret(getExpressions(`(boom)`))
+	if err == nil {
+		t.Fatal("Expecting error")
+	}
+	assertString(t, "runtime error. boom", err.Error())
+}
+
+func TestNth(t *testing.T) {
+	ret := run(t, `(nth (list 1 2 3) 2)`)
+	assertNumber(t, 3, ret)
+}
+
+func TestErrorPositionInsideFunction(t *testing.T) {
+	exprs := getExpressions(`(defn f (x)
+	(+ x "a"))
+(f 1)`)
+	intr := NewInterpreter()
+	_, err := intr.Interpret(exprs)
+	if err == nil {
+		t.Fatal("Expecting error")
+	}
+	assertString(t, "2:2: runtime error. '+' expects a number as argument 2 but got string", err.Error())
+}
+
+func TestRuntimeErrorFrames(t *testing.T) {
+	exprs := getExpressions(`(defn g (y) (+ y "a"))
+(defn f (x) (g x) x)
+(set h (fn () (f 1) nil))
+(h)`)
+	intr := NewInterpreter()
+	_, err := intr.Interpret(exprs)
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("Expected *RuntimeError but got %T", err)
+	}
+	assertString(t, "1:13", rerr.Pos.String())
+	if len(rerr.Frames) != 3 {
+		t.Fatalf("Expected 3 frames but got %v", rerr.Frames)
+	}
+	assertString(t, "4:1: in anonymous function", rerr.Frames[0].String())
+	assertString(t, "3:15: in f", rerr.Frames[1].String())
+	assertString(t, "2:13: in g", rerr.Frames[2].String())
+	if len(intr.stack) != 0 {
+		t.Fatalf("Expected call stack to be unwound but got %v", intr.stack)
+	}
+}
+
+func TestTracebackCollapsesRepeatedFrames(t *testing.T) {
+	exprs := getExpressions(`(defn f (n) (if (= n 0) (car n) (+ 1 (f (- n 1)))))
+(f 100)`)
+	intr := NewInterpreter()
+	_, err := intr.Interpret(exprs)
+	rerr := err.(*RuntimeError)
+	if len(rerr.Frames) != 101 {
+		t.Fatalf("Expected 101 frames but got %v", len(rerr.Frames))
+	}
+	expected := "Traceback (most recent call last):\n" +
+		"  2:1: in f\n" +
+		"  1:38: in f\n" +
+		"  ... repeated 99 more times\n"
+	assertString(t, expected, rerr.Traceback())
+}
+
+func TestTopLevelErrorHasNoFrames(t *testing.T) {
+	intr := NewInterpreter()
+	_, err := intr.Interpret(getExpressions(`(+ 1 nil)`))
+	rerr := err.(*RuntimeError)
+	if len(rerr.Frames) != 0 {
+		t.Fatalf("Expected no frames but got %v", rerr.Frames)
+	}
+}
+
+func TestTailCallsReplaceFrames(t *testing.T) {
+	exprs := getExpressions(`(defn g (y) (+ y "a"))
+(defn f (x) (g x))
+(f 1)`)
+	intr := NewInterpreter()
+	_, err := intr.Interpret(exprs)
+	rerr := err.(*RuntimeError)
+	if len(rerr.Frames) != 1 {
+		t.Fatalf("Expected 1 frame but got %v", rerr.Frames)
+	}
+	assertString(t, "2:13: in g", rerr.Frames[0].String())
+}
+
+func TestTailRecursionRunsInConstantStack(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping million element list in short mode")
+	}
+	ret := run(t, `
+	(set l nil)
+	(for (set i 0) (lt i 1000000) (set i (+ i 1))
+		(set l (cons 1 l)))
+	(defn sum-list (l acc)
+		(if l
+			(sum-list (cdr l) (+ acc (car l)))
+			acc))
+	(sum-list l 0)`)
+	assertNumber(t, 1000000, ret)
+}
+
+func TestMutualTailRecursion(t *testing.T) {
+	ret := run(t, `
+	(defn is-even (n) (if (= n 0) t (is-odd (- n 1))))
+	(defn is-odd (n) (if (= n 0) nil (is-even (- n 1))))
+	(is-even 100001)`)
+	if ret != nil {
+		t.Fatalf("Expected nil but got %v", ret)
+	}
+}
+
+func TestQuoteSymbol(t *testing.T) {
+	ret := run(t, `'foo`)
+	assertString(t, "foo", ret.(symbol.Symbol).Name)
+
+	ret = run(t, `(= 'foo (quote foo))`)
+	assert(t, ret.(bool))
+}
+
+func TestQuoteList(t *testing.T) {
+	ret := run(t, `(car (cdr '(1 (+ 2 3) x)))`)
+	assertString(t, "(+ 2 3)", ret.(cons.ConsCell).String())
+}
+
+func TestQuasiquote(t *testing.T) {
+	ret := run(t, "(set x 5) (set xs (list 1 2)) `(a ,x ,@xs (b ,(+ x 1)) ,@nil end)")
+	assertString(t, "(a 5 1 2 (b 6) end)", ret.(cons.ConsCell).String())
+
+	ret = run(t, "(set x 5) (quasiquote (a (unquote x)))")
+	assertString(t, "(a 5)", ret.(cons.ConsCell).String())
+}
+
+func TestUnquoteSplicingNotList(t *testing.T) {
+	intr := NewInterpreter()
+	_, err := intr.Interpret(getExpressions("`(a ,@5)"))
+	assertString(t, "1:5: runtime error. unquote-splicing expects a list but got integer", err.Error())
+}
+
+func TestDefmacro(t *testing.T) {
+	ret := run(t, `
+	(defmacro my-when (cond &rest body)
+		`+"`"+`(if ,cond ((fn () ,@body)) nil))
+	(set x 0)
+	(my-when (= 1 1) (set x 10) (+ x 1))`)
+	assertNumber(t, 11, ret)
+}
+
+func TestMacroArgsAreNotEvaluated(t *testing.T) {
+	ret := run(t, `
+	(defmacro first-sym (a b) (list 'quote a))
+	(first-sym undefined-thing (also undefined))`)
+	assertString(t, "undefined-thing", ret.(symbol.Symbol).Name)
+}
+
+func TestMacroArgsAreData(t *testing.T) {
+	ret := run(t, `
+	(defmacro quote-all (&rest forms) (list 'quote forms))
+	(quote-all (if) (let x) ,y)`)
+	assertString(t, "((if) (let x) (unquote y))", ret.(cons.ConsCell).String())
+
+	// Other forms are parsed before anything runs, even if they never are.
+	var out strings.Builder
+	intr := NewInterpreter()
+	intr.Stdout = &out
+	source := "(prn \"side effect\")\n(defn f () (prn (if)))\n(prn \"more\")"
+	lex := lexer.NewLexer(source)
+	tokens, _ := lex.GetTokens()
+	psr := parser.NewParser(tokens)
+	psr.KnownMacros(intr.IsMacro)
+	_, err := psr.GetExpressions()
+	if err == nil {
+		t.Fatal("Expected a parse error")
+	}
+	assertString(t, "2:17: parse error. if expects a condition and a true branch", err.Error())
+
+	// Macros defined by earlier source take data too.
+	intr.Interpret(getExpressions(`(defmacro quote-all (&rest forms) (list 'quote forms))`))
+	lex = lexer.NewLexer(`(quote-all (if))`)
+	tokens, _ = lex.GetTokens()
+	psr = parser.NewParser(tokens)
+	psr.KnownMacros(intr.IsMacro)
+	exprs, err := psr.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	ret, err = intr.Interpret(exprs)
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	assertString(t, "((if))", ret.(cons.ConsCell).String())
+	assertString(t, "", out.String())
+}
+
+func TestMacroExpandedOnce(t *testing.T) {
+	ret := run(t, `
+	(set expansions 0)
+	(defmacro counted (x)
+		(set expansions (+ expansions 1))
+		x)
+	(defn add-one (n) (counted (+ n 1)))
+	(set i 0)
+	(while (< i 5)
+		(set i (counted (add-one i))))
+	(list i expansions)`)
+	assertString(t, "(5 2)", ret.(cons.ConsCell).String())
+
+	ret = run(t, `
+	(defmacro sym () `+"`"+`(quote ,(gensym)))
+	(defn f () (sym))
+	(= (f) (f))`)
+	assert(t, ret.(bool))
+
+	// Redefining a macro expands its calls again.
+	ret = run(t, `
+	(defmacro version () 1)
+	(defn f () (version))
+	(set before (f))
+	(defmacro version () 2)
+	(list before (f))`)
+	assertString(t, "(1 2)", ret.(cons.ConsCell).String())
+
+	ret = run(t, `
+	(defmacro one () 1)
+	(defmacro two () 2)
+	(defn f (m) (set g m) (g))
+	(set g one)
+	(list (f one) (f two))`)
+	assertString(t, "(1 2)", ret.(cons.ConsCell).String())
+}
+
+func TestMacroExpandingToMacro(t *testing.T) {
+	ret := run(t, `
+	(defmacro my-unless (c a b) `+"`"+`(if ,c ,b ,a))
+	(defmacro my-not-unless (c a b) `+"`"+`(my-unless ,c ,b ,a))
+	(my-not-unless (= 1 2) "yes" "no")`)
+	assertString(t, "no", ret.(string))
+}
+
+func TestMacroexpand(t *testing.T) {
+	ret := run(t, `
+	(defmacro inc (v) `+"`"+`(set ,v (+ ,v 1)))
+	(defmacro inc-twice (v) `+"`"+`(inc ,v))
+	(list (macroexpand-1 '(inc-twice x)) (macroexpand '(inc-twice x)) (macroexpand '(+ 1 2)))`)
+	assertString(t, "((inc x) (set x (+ x 1)) (+ 1 2))", ret.(cons.ConsCell).String())
+}
+
+func TestGensym(t *testing.T) {
+	ret := run(t, `
+	(defmacro swap (a b)
+		((fn (g) `+"`"+`((fn (,g) (set ,a ,b) (set ,b ,g)) ,a))
+			(gensym)))
+	(set tmp 1)
+	(set other 2)
+	(swap tmp other)
+	(list tmp other)`)
+	assertString(t, "(2 1)", ret.(cons.ConsCell).String())
+
+	ret = run(t, `(= (gensym) (gensym))`)
+	assert(t, !ret.(bool))
+}
+
+func TestLet(t *testing.T) {
+	ret := run(t, `
+	(set a 100)
+	(let ((a 1) (b 2))
+		(set a (+ a 10))
+		(+ a b))`)
+	assertNumber(t, 13, ret)
+
+	ret = run(t, `(set a 100) (let ((a 1)) a) a`)
+	assertNumber(t, 100, ret)
+}
+
+func TestLetBindingsDisappear(t *testing.T) {
+	exprs := getExpressions(`(let ((tmp 1)) tmp) tmp`)
+	intr := NewInterpreter()
+	_, err := intr.Interpret(exprs)
+	assertString(t, "1:21: runtime error. Could not find symbol 'tmp'", err.Error())
+}
+
+func TestLetValuesSeeOuterScope(t *testing.T) {
+	ret := run(t, `(set a 1) (let ((a 2) (b a)) b)`)
+	assertNumber(t, 1, ret)
+
+	ret = run(t, `(set a 1) (let* ((a 2) (b a)) b)`)
+	assertNumber(t, 2, ret)
+}
+
+func TestLetShadowsBuiltins(t *testing.T) {
+	ret := run(t, `(list (let ((+ -)) (+ 5 3)) (+ 5 3))`)
+	assertString(t, "(2 8)", ret.(cons.ConsCell).String())
+}
+
+func TestLetBodyIsTailPosition(t *testing.T) {
+	ret := run(t, `
+	(defn count-down (n)
+		(let ((m (- n 1)))
+			(if (= m 0) "done" (count-down m))))
+	(count-down 100000)`)
+	assertString(t, "done", ret.(string))
+}
+
+func TestIfWithoutElse(t *testing.T) {
+	ret := run(t, `(if (= 1 2) "yes")`)
+	if ret != nil {
+		t.Fatalf("Expected nil but got %v", ret)
+	}
+	ret = run(t, `(if (= 1 1) "yes")`)
+	assertString(t, "yes", ret.(string))
+}
+
+func TestCondExpr(t *testing.T) {
+	intr := NewInterpreter()
+	sources := []string{"(set x 1)", "(set x 2)", "(set x 3)"}
+	expected := []string{"one", "two", "many"}
+	for i, s := range sources {
+		ret, err := intr.Interpret(getExpressions(s + `
+		(cond
+			((= x 1) "one")
+			((= x 2) "two")
+			(else "many"))`))
+		if err != nil {
+			t.Fatalf("Not expecting error but got %v", err)
+		}
+		assertString(t, expected[i], ret.(string))
+	}
+
+	ret := run(t, `(cond ((= 1 2) "no"))`)
+	if ret != nil {
+		t.Fatalf("Expected nil but got %v", ret)
+	}
+	ret = run(t, `(cond (nil 1) ((+ 1 2)))`)
+	assertNumber(t, 3, ret)
+}
+
+func TestWhenUnless(t *testing.T) {
+	ret := run(t, `(set x 0) (when t (set x 1) (+ x 1))`)
+	assertNumber(t, 2, ret)
+	ret = run(t, `(set x 0) (when nil (set x 1)) x`)
+	assertNumber(t, 0, ret)
+	ret = run(t, `(unless nil "ran")`)
+	assertString(t, "ran", ret.(string))
+	ret = run(t, `(unless t "ran")`)
+	if ret != nil {
+		t.Fatalf("Expected nil but got %v", ret)
+	}
+}
+
+func TestDo(t *testing.T) {
+	ret := run(t, `(set x 0) (do (set x 5) (* x 2))`)
+	assertNumber(t, 10, ret)
+	ret = run(t, `(progn)`)
+	if ret != nil {
+		t.Fatalf("Expected nil but got %v", ret)
+	}
+}
+
+func TestReturn(t *testing.T) {
+	ret := run(t, `
+	(defn first-negative (lst)
+		(while lst
+			(if (lt (car lst) 0)
+				(return (car lst)))
+			(set lst (cdr lst)))
+		nil)
+	(first-negative (list 3 1 (- 0 4) 1 (- 0 5)))`)
+	assertNumber(t, -4, ret)
+
+	ret = run(t, `
+	(defn f (x)
+		(when (gt x 10) (return "big"))
+		"small")
+	(list (f 1) (f 11))`)
+	assertString(t, `("small" "big")`, ret.(cons.ConsCell).String())
+
+	ret = run(t, `(defn f () (return) 1) (f)`)
+	if ret != nil {
+		t.Fatalf("Expected nil but got %v", ret)
+	}
+}
+
+func TestReturnIsScopedToInnermostFunction(t *testing.T) {
+	ret := run(t, `
+	(defn outer ()
+		(set inner (fn () (return 1) 2))
+		(+ (inner) 10))
+	(outer)`)
+	assertNumber(t, 11, ret)
+
+	ret = run(t, `
+	(defn g (x) (+ x 1))
+	(defn f () (g (return 5)) 6)
+	(f)`)
+	assertNumber(t, 5, ret)
+}
+
+func TestBreakContinue(t *testing.T) {
+	ret := run(t, `
+	(set total 0)
+	(for (set i 0) (lt i 10) (set i (+ i 1))
+		(if (= (mod i 2) 0) (continue))
+		(if (gt i 6) (break))
+		(set total (+ total i)))
+	total`)
+	assertNumber(t, 9, ret)
+
+	ret = run(t, `
+	(set n 0)
+	(set outer 0)
+	(while (lt outer 3)
+		(set outer (+ outer 1))
+		(while t
+			(set n (+ n 1))
+			(break)))
+	n`)
+	assertNumber(t, 3, ret)
+}
+
+func TestControlFlowOutsideScope(t *testing.T) {
+	sources := []string{
+		`(return 1)`,
+		`(break)`,
+		`(continue)`,
+		"(defn f () (break))\n(while t (f))",
+		"(defn f () (set y 1) (continue) 2)\n(while t (f))",
+	}
+	expected := []string{
+		"1:1: runtime error. return outside of a function",
+		"1:1: runtime error. break outside of a loop",
+		"1:1: runtime error. continue outside of a loop",
+		"1:12: runtime error. break outside of a loop",
+		"1:22: runtime error. continue outside of a loop",
+	}
+	for i, s := range sources {
+		intr := NewInterpreter()
+		_, err := intr.Interpret(getExpressions(s))
+		if err == nil {
+			t.Fatalf("Expected error for %v", s)
+		}
+		assertString(t, expected[i], err.Error())
+	}
+
+	intr := NewInterpreter()
+	_, err := intr.Interpret(getExpressions("(defn f () (break))\n(while t (f))"))
+	rerr := err.(*RuntimeError)
+	if len(rerr.Frames) != 1 || rerr.Frames[0].Name != "f" {
+		t.Fatalf("Expected break error inside f but got %v", rerr.Frames)
+	}
+}
+
+func TestTryCatchThrow(t *testing.T) {
+	ret := run(t, `(try (throw "oops") (catch e (list "caught" e)))`)
+	assertString(t, `("caught" "oops")`, ret.(cons.ConsCell).String())
+
+	ret = run(t, `(try (+ 1 2) (catch e "not used"))`)
+	assertNumber(t, 3, ret)
+
+	ret = run(t, `
+	(defn risky (x)
+		(when (gt x 1) (throw x))
+		x)
+	(defn safe (x)
+		(try (risky x) (catch e (* e 10))))
+	(list (safe 1) (safe 5))`)
+	assertString(t, `(1 50)`, ret.(cons.ConsCell).String())
+}
+
+func TestCatchRuntimeError(t *testing.T) {
+	ret := run(t, `
+	(try (mod 1 2 3)
+		(catch e
+			(list (error? e) (error-kind e) (error-message e) (error-position e))))`)
+	assertString(t, `(true "arity-error" "'mod' expects 2 arguments but got 3" "2:7")`, ret.(cons.ConsCell).String())
+
+	ret = run(t, `(try (+ "a" 1) (catch e (error-kind e)))`)
+	assertString(t, "type-error", ret.(string))
+	ret = run(t, `(try undefined-thing (catch e (error-kind e)))`)
+	assertString(t, "unbound-symbol", ret.(string))
+}
+
+func TestListAndErrorBuiltinKinds(t *testing.T) {
+	tests := []struct {
+		src, kind, msg string
+	}{
+		{"(car 5)", "type-error", "'car' expects a list as argument 1 but got integer"},
+		{`(cdr "a")`, "type-error", "'cdr' expects a list as argument 1 but got string"},
+		{"(cons 1)", "arity-error", "'cons' expects 2 arguments but got 1"},
+		{"(error-kind 1)", "type-error", "'error-kind' expects an error as argument 1 but got integer"},
+		{"(error? 1 2)", "arity-error", "'error?' expects 1 argument but got 2"},
+	}
+	for _, test := range tests {
+		ret := run(t, fmt.Sprintf("(try %v (catch e (list (error-kind e) (error-message e))))", test.src))
+		assertString(t, fmt.Sprintf("(%q %q)", test.kind, test.msg), ret.(cons.ConsCell).String())
+	}
+}
+
+func TestFinally(t *testing.T) {
+	ret := run(t, `
+	(set log nil)
+	(try (set log (cons "body" log))
+		(finally (set log (cons "finally" log))))
+	log`)
+	assertString(t, `("finally" "body")`, ret.(cons.ConsCell).String())
+
+	ret = run(t, `
+	(set cleaned nil)
+	(defn f ()
+		(try (return 1)
+			(finally (set cleaned t)))
+		2)
+	(list (f) cleaned)`)
+	assertString(t, `(1 true)`, ret.(cons.ConsCell).String())
+
+	intr := NewInterpreter()
+	ret, err := intr.Interpret(getExpressions(`
+	(set cleaned nil)
+	(try (throw 1) (finally (set cleaned t)))`))
+	if err == nil {
+		t.Fatal("Expected the throw to escape")
+	}
+	ret, _ = intr.Interpret(getExpressions(`cleaned`))
+	if ret != true {
+		t.Fatal("Expected finally to run")
+	}
+}
+
+func TestUncaughtThrow(t *testing.T) {
+	intr := NewInterpreter()
+	_, err := intr.Interpret(getExpressions(`
+	(defn f (x) (throw (list x 2)))
+	(f 1)`))
+	thrown, ok := err.(*ThrowError)
+	if !ok {
+		t.Fatalf("Expected a ThrowError but got %T", err)
+	}
+	assertString(t, `(1 2)`, thrown.Value.(cons.ConsCell).String())
+	assertString(t, "2:14: runtime error. uncaught throw of (1 2)", err.Error())
+	if len(thrown.Frames) != 1 || thrown.Frames[0].Name != "f" {
+		t.Fatalf("Expected throw inside f but got %v", thrown.Frames)
+	}
+
+	// Errors raised in a catch clause are not caught by the same try.
+	_, err = intr.Interpret(getExpressions(`(try (throw 1) (catch e (throw (+ e 1))))`))
+	assertString(t, "1:25: runtime error. uncaught throw of 2", err.Error())
+}
+
+func TestNumericTower(t *testing.T) {
+	sources := []string{
+		"(+ 1 2)",
+		"(* 9223372036854775807 2)",
+		"(/ 1 3)",
+		"(+ 1/3 2/3)",
+		"(+ 1 0.5)",
+		"(mod 7.5 2)",
+		"(& 0xff 0x0f)",
+		"(<< 1 70)",
+		"(>> (<< 1 70) 70)",
+	}
+	expected := []string{
+		"int64 3",
+		"*big.Int 18446744073709551614",
+		"*big.Rat 1/3",
+		"int64 1",
+		"float64 1.5",
+		"float64 1.5",
+		"int64 15",
+		"*big.Int 1180591620717411303424",
+		"int64 1",
+	}
+	for i, s := range sources {
+		ret := run(t, s)
+		assertString(t, expected[i], fmt.Sprintf("%T %v", ret, ret))
+	}
+
+	assert(t, run(t, "(= 2 2.0)").(bool))
+	assert(t, run(t, "(lt 1/3 0.34)").(bool))
+	assert(t, run(t, "(gt 18446744073709551616 1.5)").(bool))
+}
+
+func TestDivideByZero(t *testing.T) {
+	intr := NewInterpreter()
+	_, err := intr.Interpret(getExpressions("(/ 1 0)"))
+	assertString(t, "1:1: runtime error. '/' by zero", err.Error())
+	ret := run(t, "(/ 1 0.0)")
+	assertString(t, "+Inf", fmt.Sprint(ret))
+}
+
+func TestVariadicArithmetic(t *testing.T) {
+	sources := []string{"(+ 1 2 3 4)", "(+)", "(*)", "(* 2 3 4)", "(- 5)", "(- 10 1 2)", "(/ 2)", "(/ 60 2 3)"}
+	expected := []string{"10", "0", "1", "24", "-5", "7", "1/2", "10"}
+	for i, s := range sources {
+		assertString(t, expected[i], fmt.Sprint(run(t, s)))
+	}
+}
+
+func TestComparisons(t *testing.T) {
+	sources := []string{
+		"(< 1 2 3)", "(< 1 3 2)", "(> 3 2 1)", "(<= 1 1 2)", "(>= 2 2 3)",
+		`(< "apple" "banana")`, `(> "b" "a" "a")`, "(< 1)",
+		"(= 1 1 1)", "(= 1 1 2)", "(!= 1 2)", "(not= 1 1)",
+		"(not nil)", "(not 0)",
+	}
+	expected := []bool{
+		true, false, true, true, false,
+		true, false, true,
+		true, false, true, false,
+		true, false,
+	}
+	for i, s := range sources {
+		ret := run(t, s)
+		if ret != expected[i] {
+			t.Fatalf("Expected %v to be %v but got %v", s, expected[i], ret)
+		}
+	}
+
+	intr := NewInterpreter()
+	_, err := intr.Interpret(getExpressions(`(< "a" 1)`))
+	assertString(t, "1:1: runtime error. '<' expects a string as argument 2 but got integer", err.Error())
+}
+
+func TestAndOrShortCircuit(t *testing.T) {
+	ret := run(t, `(and 1 "two" 3)`)
+	assertNumber(t, 3, ret)
+	ret = run(t, `(or nil 2 (undefined-function))`)
+	assertNumber(t, 2, ret)
+	ret = run(t, `(and 1 nil (undefined-function))`)
+	if ret != nil {
+		t.Fatalf("Expected nil but got %v", ret)
+	}
+	assert(t, run(t, `(and)`).(bool))
+	if ret := run(t, `(or)`); ret != nil {
+		t.Fatalf("Expected nil but got %v", ret)
+	}
+
+	// The last operand is in tail position.
+	ret = run(t, `
+	(defn count-down (n) (or (= n 0) (count-down (- n 1))))
+	(count-down 100000)`)
+	assert(t, ret.(bool))
+}
+
+func TestAndOrAsValues(t *testing.T) {
+	ret := run(t, `(defn apply2 (f a b) (f a b)) (list (apply2 and 1 2) (apply2 or nil 3) (apply2 and nil 4))`)
+	assertString(t, "(2 3 nil)", ret.(cons.ConsCell).String())
+}
+
+func TestSpecialFormNamesAsSymbols(t *testing.T) {
+	ret := run(t, `
+	(defn f (cond do &optional (let 3)) (+ cond do let))
+	(set when 10)
+	(list (f 1 2) ((fn (if) if) 5) when '(quote and))`)
+	assertString(t, "(6 5 10 (quote and))", ret.(cons.ConsCell).String())
+}
+
+func TestNegativeLiterals(t *testing.T) {
+	assertNumber(t, -8, run(t, "(+ -5 -3)"))
+	assertNumber(t, 2, run(t, "(- -5 -7)"))
+	assertNumber(t, 0.5, run(t, "(* .25 +2)"))
+}
+
+func TestLenSubstr(t *testing.T) {
+	assertNumber(t, 7, run(t, `(len "naïve 😀")`))
+	assertNumber(t, 3, run(t, `(len (list 1 2 3))`))
+	assertNumber(t, 0, run(t, `(len nil)`))
+	assertString(t, "ïve", run(t, `(substr "naïve 😀" 2 5)`).(string))
+	assertString(t, "😀", run(t, `(substr "naïve 😀" 6)`).(string))
+
+	intr := NewInterpreter()
+	_, err := intr.Interpret(getExpressions(`(substr "abc" 2 5)`))
+	assertString(t, "1:1: runtime error. 'substr' range 2 to 5 is out of bounds for a string of length 3", err.Error())
+}
+
+func TestBooleans(t *testing.T) {
+	sources := []string{"true", "false", "#t", "#f", "t", "(= 1 2)", "(if false 1 2)", "(if #t 1 2)", "(= false nil)", "(= true t)"}
+	expected := []interface{}{true, false, true, false, true, false, int64(2), int64(1), false, true}
+	for i, s := range sources {
+		if ret := run(t, s); ret != expected[i] {
+			t.Fatalf("Expected %v to be %v but got %v", s, expected[i], ret)
+		}
+	}
+	assertString(t, "(true false nil)", run(t, "(list #t false nil)").(cons.ConsCell).String())
+}
+
+// nil is the empty list. It is the only list that is false, and it is a
+// different value from false.
+func TestNilIsTheEmptyList(t *testing.T) {
+	for _, s := range []string{"'()", "(list)", "(cdr '(1))", "(cdr nil)", "(car nil)", "`()"} {
+		if ret := run(t, s); ret != nil {
+			t.Fatalf("Expected %v to be nil but got %v", s, ret)
+		}
+	}
+	sources := []string{"(= nil '())", "(= (list) nil)", "(if '() 1 2)", "(if (list 1) 1 2)", "(= '(nil) (list nil))", "(len '())", "(= false '())"}
+	expected := []interface{}{true, true, int64(2), int64(1), true, int64(0), false}
+	for i, s := range sources {
+		if ret := run(t, s); ret != expected[i] {
+			t.Fatalf("Expected %v to be %v but got %v", s, expected[i], ret)
+		}
+	}
+	// A list holding nil is not empty.
+	assertString(t, "(nil)", run(t, "(cons nil nil)").(cons.ConsCell).String())
+}
+
+func TestGeneratedWrappers(t *testing.T) {
+	assertString(t, "a-b-c", run(t, `(strings/Join (strings/Fields " a b  c ") "-")`).(string))
+	assertString(t, `("key" "value" true)`, run(t, `(strings/Cut "key=value" "=")`).(cons.ConsCell).String())
+	assertString(t, "xxx", run(t, `(strings/Repeat "x" 3)`).(string))
+	if ret := run(t, `(strings/ContainsRune "café" 233)`); ret != true {
+		t.Fatalf("Expected true but got %v", ret)
+	}
+	if ret := run(t, `(strings/Split "" ",")`); ret.(cons.ConsCell).String() != `("")` {
+		t.Fatalf("Expected (\"\") but got %v", ret)
+	}
+
+	sources := []string{`(strings/Repeat "x" -1)`, `(strings/ContainsRune "a" 1099511627776)`, `(strings/Join '(1) "")`}
+	expected := []string{"error", "value-error", "type-error"}
+	for i, s := range sources {
+		ret := run(t, fmt.Sprintf("(try %v (catch e (error-kind e)))", s))
+		assertString(t, expected[i], ret.(string))
+	}
+}
+
+// runIO runs s with the given input and returns what it printed to stdout
+// and stderr.
+func runIO(t *testing.T, s string, input string) (string, string) {
+	var stdout, stderr strings.Builder
+	intr := NewInterpreter()
+	intr.Stdout = &stdout
+	intr.Stderr = &stderr
+	intr.Stdin = strings.NewReader(input)
+	if _, err := intr.Interpret(getExpressions(s)); err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	return stdout.String(), stderr.String()
+}
+
+func TestPrinting(t *testing.T) {
+	stdout, stderr := runIO(t, `
+		(prn "Hello" "world" 1 2.0 '(a "b") nil true)
+		(print "no" "newline")
+		(print "!")
+		(prn)
+		(eprn "warning:" 3)`, "")
+	assertString(t, "Hello world 1 2.0 (a \"b\") nil true\nno newline!\n", stdout)
+	assertString(t, "warning: 3\n", stderr)
+}
+
+func TestPrintingFunctions(t *testing.T) {
+	stdout, _ := runIO(t, `
+		(defn double (x) (* x 2))
+		(defmacro my-when (c &rest body) nil)
+		(prn car)
+		(prn (fn (x) x))
+		(prn double my-when prn (list 1 +))`, "")
+	assertString(t, "#<builtin>\n#<function>\n#<function double> #<macro my-when> #<builtin> (1 #<builtin>)\n", stdout)
+}
+
+func TestReading(t *testing.T) {
+	stdout, _ := runIO(t, `
+		(prn (read-line))
+		(prn (read-line))
+		(prn (read-all))
+		(prn (read-line) (read-all))`, "first\r\nsecond\nthe\nrest")
+	assertString(t, "first\nsecond\nthe\nrest\nnil \n", stdout)
+
+	stdout, _ = runIO(t, `
+		(set total 0)
+		(set line (read-line))
+		(while line
+			(set total (+ total (len line)))
+			(set line (read-line)))
+		(prn total)`, "a\nbb\n\nccc")
+	assertString(t, "6\n", stdout)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestPrintErrors(t *testing.T) {
+	intr := NewInterpreter()
+	intr.Stdout = failingWriter{}
+	ret, err := intr.Interpret(getExpressions(`(try (prn "x") (catch e (error-message e)))`))
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	assertString(t, "'prn' failed: disk full", ret.(string))
+
+	_, err = intr.Interpret(getExpressions(`(read-line 1)`))
+	if err == nil {
+		t.Fatal("Expected an arity error")
+	}
+}
+
+func interpretWithLimits(limits Limits, s string) (interface{}, error) {
+	intr := NewInterpreter()
+	intr.Limits = limits
+	return intr.Interpret(getExpressions(s))
+}
+
+func assertLimitExceeded(t *testing.T, err error, msg string) {
+	t.Helper()
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected the limit to be exceeded but got %v", err)
+	}
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) || rerr.Kind != LimitExceeded {
+		t.Fatalf("Expected a limit-exceeded runtime error but got %v", err)
+	}
+	assertString(t, msg, rerr.Msg)
+}
+
+func TestStepLimit(t *testing.T) {
+	_, err := interpretWithLimits(Limits{Steps: 1000}, "(while t 1)")
+	assertLimitExceeded(t, err, "runtime error. step limit of 1000 exceeded")
+
+	ret, err := interpretWithLimits(Limits{Steps: 1000}, "(+ 1 2)")
+	if err != nil || ret != int64(3) {
+		t.Fatalf("Expected 3 but got %v, %v", ret, err)
+	}
+
+	// The budget is for each call to Interpret.
+	intr := NewInterpreter()
+	intr.Limits.Steps = 100
+	for i := 0; i < 3; i++ {
+		if _, err := intr.Interpret(getExpressions("(set i 0) (while (< i 5) (set i (+ i 1)))")); err != nil {
+			t.Fatalf("Not expecting error but got %v", err)
+		}
+	}
+}
+
+func TestDepthLimit(t *testing.T) {
+	_, err := interpretWithLimits(Limits{Depth: 50}, `
+		(defn count (n) (if (= n 0) 0 (+ 1 (count (- n 1)))))
+		(count 100)`)
+	assertLimitExceeded(t, err, "runtime error. call depth limit of 50 exceeded")
+
+	// Tail calls replace their caller so can recurse without limit.
+	ret, err := interpretWithLimits(Limits{Depth: 50}, `
+		(defn loop (n acc) (if (= n 0) acc (loop (- n 1) (+ acc 1))))
+		(loop 1000 0)`)
+	if err != nil || ret != int64(1000) {
+		t.Fatalf("Expected 1000 but got %v, %v", ret, err)
+	}
+
+	// A new interpreter has a depth limit so deep recursion can't overflow
+	// the Go stack.
+	intr := NewInterpreter()
+	_, err = intr.Interpret(getExpressions(`
+		(defn f (n) (if (= n 0) 0 (+ 1 (f (- n 1)))))
+		(f 10000000)`))
+	assertLimitExceeded(t, err, "runtime error. call depth limit of 10000 exceeded")
+
+	// So can macros that expand without end.
+	intr = NewInterpreter()
+	_, err = intr.Interpret(getExpressions(`
+		(defmacro m () '(+ 1 (m)))
+		(prn (m))`))
+	assertLimitExceeded(t, err, "runtime error. call depth limit of 10000 exceeded")
+	_, err = interpretWithLimits(Limits{Depth: 50}, `
+		(defmacro nest (n) (if (= n 0) 0 `+"`"+`(+ 1 (nest ,(- n 1)))))
+		(nest 100)`)
+	assertLimitExceeded(t, err, "runtime error. call depth limit of 50 exceeded")
+	ret, err = interpretWithLimits(Limits{Depth: 50}, `
+		(defmacro nest (n) (if (= n 0) 0 `+"`"+`(+ 1 (nest ,(- n 1)))))
+		(nest 40)`)
+	if err != nil || ret != int64(40) {
+		t.Fatalf("Expected 40 but got %v, %v", ret, err)
+	}
+}
+
+func TestConsCellLimit(t *testing.T) {
+	sources := []string{
+		"(set l nil) (while t (set l (cons 1 l)))",
+		"(while t (list 1 2 3))",
+		"(defn f (&rest xs) xs) (while t (f 1 2 3))",
+		"(while t `(1 ,@(list) 2))",
+		`(while t (strings/Fields "a b c"))`,
+	}
+	for _, s := range sources {
+		_, err := interpretWithLimits(Limits{ConsCells: 100}, s)
+		assertLimitExceeded(t, err, "runtime error. cons cell limit of 100 exceeded")
+	}
+
+	ret, err := interpretWithLimits(Limits{ConsCells: 3}, "(len (list 1 2 3))")
+	if err != nil || ret != int64(3) {
+		t.Fatalf("Expected 3 but got %v, %v", ret, err)
+	}
+}
+
+func TestLimitsCantBeCaught(t *testing.T) {
+	var stdout strings.Builder
+	intr := NewInterpreter()
+	intr.Stdout = &stdout
+	intr.Limits.Steps = 1000
+	_, err := intr.Interpret(getExpressions(`
+		(try
+			(while t 1)
+			(catch e (prn "caught"))
+			(finally (prn "finally")))`))
+	assertLimitExceeded(t, err, "runtime error. step limit of 1000 exceeded")
+	assertString(t, "", stdout.String())
+}
+
+func TestInterpretContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	intr := NewInterpreter()
+	_, err := intr.InterpretContext(ctx, getExpressions("(try (while t 1) (catch e 1))"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to be exceeded but got %v", err)
+	}
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) || rerr.Kind != Cancelled {
+		t.Fatalf("Expected a cancelled runtime error but got %v", err)
+	}
+	assertString(t, "runtime error. evaluation stopped: context deadline exceeded", rerr.Msg)
+
+	// The interpreter can carry on with a new context.
+	ret, err := intr.InterpretContext(context.Background(), getExpressions("(+ 1 2)"))
+	if err != nil || ret != int64(3) {
+		t.Fatalf("Expected 3 but got %v, %v", ret, err)
+	}
 }
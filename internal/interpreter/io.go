@@ -0,0 +1,74 @@
+package interpreter
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/danwhitford/danlisp/internal/printer"
+	"github.com/danwhitford/danlisp/internal/stdlib/builtin"
+)
+
+// writer returns a builtin that prints its arguments, separated by spaces
+// and followed by end, to one of the interpreter's output streams.
+func writer(name string, stream func(*Interpreter) io.Writer, end string) func(*Interpreter, []interface{}) (interface{}, error) {
+	return func(interpreter *Interpreter, argv []interface{}) (interface{}, error) {
+		strs := make([]string, len(argv))
+		for i, v := range argv {
+			strs[i] = printer.Display(v)
+		}
+		if _, err := io.WriteString(stream(interpreter), strings.Join(strs, " ")+end); err != nil {
+			return nil, builtin.Failed(name, err)
+		}
+		return nil, nil
+	}
+}
+
+func stdout(interpreter *Interpreter) io.Writer {
+	return interpreter.Stdout
+}
+
+func stderr(interpreter *Interpreter) io.Writer {
+	return interpreter.Stderr
+}
+
+// input returns a buffered reader over Stdin. It is kept between calls so
+// that input read ahead by one call is not lost to the next, and replaced
+// if Stdin changes.
+func (interpreter *Interpreter) input() *bufio.Reader {
+	if interpreter.stdin == nil || interpreter.stdinSource != interpreter.Stdin {
+		interpreter.stdin = bufio.NewReader(interpreter.Stdin)
+		interpreter.stdinSource = interpreter.Stdin
+	}
+	return interpreter.stdin
+}
+
+// readLine reads the next line of input without its line ending, or returns
+// nil at the end of the input.
+func readLine(interpreter *Interpreter, argv []interface{}) (interface{}, error) {
+	if err := builtin.Arity("read-line", argv, 0); err != nil {
+		return nil, err
+	}
+	line, err := interpreter.input().ReadString('\n')
+	if err == io.EOF {
+		if line == "" {
+			return nil, nil
+		}
+	} else if err != nil {
+		return nil, builtin.Failed("read-line", err)
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// readAll reads the rest of the input.
+func readAll(interpreter *Interpreter, argv []interface{}) (interface{}, error) {
+	if err := builtin.Arity("read-all", argv, 0); err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(interpreter.input())
+	if err != nil {
+		return nil, builtin.Failed("read-all", err)
+	}
+	return string(b), nil
+}
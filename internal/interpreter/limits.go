@@ -0,0 +1,131 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+)
+
+// Kinds of error raised when evaluation is stopped.
+const (
+	LimitExceeded = "limit-exceeded"
+	Cancelled     = "cancelled"
+)
+
+// ErrLimitExceeded is wrapped by the error returned when a program goes over
+// one of the interpreter's Limits.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// DefaultDepth is the call depth limit of a new interpreter. Without a limit
+// deep recursion overflows the Go stack, which crashes the host program
+// rather than returning an error.
+const DefaultDepth = 10000
+
+// Limits bounds the work a program can do in one call to Interpret. A limit
+// of zero means there is none.
+type Limits struct {
+	// Steps is the number of expressions that can be evaluated.
+	Steps int
+	// Depth is how deeply function calls and macro expansions can nest. A
+	// call in tail position replaces its caller, so it does not count.
+	Depth int
+	// ConsCells is the number of list cells that can be allocated.
+	ConsCells int
+}
+
+// stopError stops evaluation. Unlike other errors it can't be caught by
+// try, so a program can't carry on past a limit or a cancelled context.
+type stopError struct {
+	kind string
+	msg  string
+	err  error
+}
+
+func (err *stopError) Error() string {
+	return err.msg
+}
+
+func (err *stopError) Unwrap() error {
+	return err.err
+}
+
+func limitExceeded(what string, limit int) error {
+	return &stopError{
+		kind: LimitExceeded,
+		msg:  fmt.Sprintf("runtime error. %v limit of %d exceeded", what, limit),
+		err:  ErrLimitExceeded,
+	}
+}
+
+func isStop(err error) bool {
+	var stop *stopError
+	return errors.As(err, &stop)
+}
+
+// start resets the interpreter's budgets for a new run under ctx.
+func (interpreter *Interpreter) start(ctx context.Context) {
+	interpreter.ctx = ctx
+	interpreter.done = ctx.Done()
+	interpreter.steps = 0
+	interpreter.cells = 0
+}
+
+// tick counts an evaluation step, stopping evaluation once the step limit
+// is passed or the context is done.
+func (interpreter *Interpreter) tick() error {
+	interpreter.steps++
+	if limit := interpreter.Limits.Steps; limit > 0 && interpreter.steps > limit {
+		return limitExceeded("step", limit)
+	}
+	select {
+	case <-interpreter.done:
+		err := interpreter.ctx.Err()
+		return &stopError{kind: Cancelled, msg: fmt.Sprintf("runtime error. evaluation stopped: %v", err), err: err}
+	default:
+	}
+	return nil
+}
+
+// checkDepth stops evaluation if going deeper than depth calls, on top of
+// the expansions being evaluated, would pass the depth limit.
+func (interpreter *Interpreter) checkDepth(depth int) error {
+	if limit := interpreter.Limits.Depth; limit > 0 && depth+interpreter.expanding >= limit {
+		return limitExceeded("call depth", limit)
+	}
+	return nil
+}
+
+// alloc counts n newly allocated cons cells against the limit.
+func (interpreter *Interpreter) alloc(n int) error {
+	interpreter.cells += n
+	if limit := interpreter.Limits.ConsCells; limit > 0 && interpreter.cells > limit {
+		return limitExceeded("cons cell", limit)
+	}
+	return nil
+}
+
+// allocates wraps a builtin that returns new lists so that the cells it
+// allocates, as counted by cells, count towards the limit.
+func allocates(fn func([]interface{}) (interface{}, error), cells func(argv []interface{}, result interface{}) int) func(*Interpreter, []interface{}) (interface{}, error) {
+	return func(interpreter *Interpreter, argv []interface{}) (interface{}, error) {
+		val, err := fn(argv)
+		if err != nil {
+			return nil, err
+		}
+		if err := interpreter.alloc(cells(argv, val)); err != nil {
+			return nil, err
+		}
+		return val, nil
+	}
+}
+
+// countCells counts every cell in a value that was built from scratch.
+func countCells(_ []interface{}, v interface{}) int {
+	n := 0
+	for cell, ok := v.(cons.ConsCell); ok; cell, ok = cell.Cdr.(cons.ConsCell) {
+		n += 1 + countCells(nil, cell.Car)
+	}
+	return n
+}
@@ -0,0 +1,125 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/danwhitford/danlisp/internal/callable"
+	"github.com/danwhitford/danlisp/internal/environment"
+	"github.com/danwhitford/danlisp/internal/expr"
+	"github.com/danwhitford/danlisp/internal/parser"
+	"github.com/danwhitford/danlisp/internal/stdlib/builtin"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/symbol"
+	"github.com/danwhitford/danlisp/internal/token"
+)
+
+// lookupMacro reports whether a sequence is a call to a macro.
+func (interpreter *Interpreter) lookupMacro(seq expr.Seq) (callable.Macro, bool) {
+	head, ok := seq.Exprs[0].(expr.Symbol)
+	if !ok {
+		return callable.Macro{}, false
+	}
+	val, ok := interpreter.environment.Get(head.Name)
+	if !ok {
+		return callable.Macro{}, false
+	}
+	macro, ok := val.(callable.Macro)
+	return macro, ok
+}
+
+// expandSeq applies a macro to the unevaluated forms of a call and returns
+// the expression to evaluate in its place. Each call is expanded the first
+// time it is evaluated and the expansion reused after that, for as long as
+// its head names the same macro.
+func (interpreter *Interpreter) expandSeq(macro callable.Macro, seq expr.Seq) (expr.Expr, error) {
+	if len(seq.Tokens) == 0 {
+		return nil, fmt.Errorf("runtime error. cannot expand macro '%v' without its source", macro.Callable.Name)
+	}
+	id := identify(macro)
+	if seq.Expansion != nil && seq.Expansion.Expr != nil && seq.Expansion.Macro == id {
+		return seq.Expansion.Expr, nil
+	}
+	p := parser.NewParser(seq.Tokens)
+	data, err := p.GetData()
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := interpreter.expand(macro, data[0].(cons.ConsCell), seq.Pos)
+	if err != nil {
+		return nil, err
+	}
+	ex, err := parser.FromDatum(expanded, seq.Pos)
+	if err != nil {
+		return nil, err
+	}
+	if seq.Expansion != nil {
+		*seq.Expansion = expr.Expansion{Macro: id, Expr: ex}
+	}
+	return ex, nil
+}
+
+// macroID identifies a macro by the defmacro it came from and the
+// environment it closes over. Macros made by the same defmacro in the same
+// environment expand the same way.
+type macroID struct {
+	body    *expr.Expr
+	closure *environment.Environment
+}
+
+func identify(macro callable.Macro) macroID {
+	id := macroID{closure: macro.Callable.Closure}
+	if len(macro.Callable.Body) > 0 {
+		id.body = &macro.Callable.Body[0]
+	}
+	return id
+}
+
+func (interpreter *Interpreter) expand(macro callable.Macro, form cons.ConsCell, pos token.Pos) (interface{}, error) {
+	args, ok := listToSlice(form.Cdr)
+	if !ok {
+		return nil, fmt.Errorf("runtime error. macro '%v' called with an improper list", macro.Callable.Name)
+	}
+	return interpreter.call(macro.Callable, args, pos)
+}
+
+// expandOnce expands a form if it is a call to a macro, reporting whether
+// it did so.
+func (interpreter *Interpreter) expandOnce(form interface{}) (interface{}, bool, error) {
+	cell, ok := form.(cons.ConsCell)
+	if !ok {
+		return form, false, nil
+	}
+	head, ok := cell.Car.(symbol.Symbol)
+	if !ok {
+		return form, false, nil
+	}
+	val, _ := interpreter.environment.Get(head.Name)
+	macro, ok := val.(callable.Macro)
+	if !ok {
+		return form, false, nil
+	}
+	expanded, err := interpreter.expand(macro, cell, token.Pos{})
+	return expanded, err == nil, err
+}
+
+func macroexpand1(interpreter *Interpreter, argv []interface{}) (interface{}, error) {
+	if err := builtin.Arity("macroexpand-1", argv, 1); err != nil {
+		return nil, err
+	}
+	expanded, _, err := interpreter.expandOnce(argv[0])
+	return expanded, err
+}
+
+func macroexpand(interpreter *Interpreter, argv []interface{}) (interface{}, error) {
+	if err := builtin.Arity("macroexpand", argv, 1); err != nil {
+		return nil, err
+	}
+	form := argv[0]
+	for {
+		expanded, ok, err := interpreter.expandOnce(form)
+		if err != nil || !ok {
+			return expanded, err
+		}
+		form = expanded
+	}
+}
@@ -1,159 +1,355 @@
 package lexer
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/danwhitford/danlisp/internal/number"
 	"github.com/danwhitford/danlisp/internal/token"
 )
 
+// Lexer splits source into tokens. It works on runes, so positions count
+// characters rather than bytes.
 type Lexer struct {
-	length  int
-	current int
-	source  string
-	line    int
+	length    int
+	current   int
+	source    []rune
+	file      string
+	line      int
+	lineStart int
 }
 
 func NewLexer(input string) Lexer {
+	return NewFileLexer("", input)
+}
+
+// NewFileLexer creates a lexer whose token positions name the given file.
+func NewFileLexer(file string, input string) Lexer {
+	source := []rune(input)
 	return Lexer{
-		current: 0,
-		length:  len(input),
-		source:  input,
-		line:    1,
+		current:   0,
+		length:    len(source),
+		source:    source,
+		file:      file,
+		line:      1,
+		lineStart: 0,
 	}
 }
 
 func (lexer *Lexer) GetTokens() ([]token.Token, error) {
 	var tokens []token.Token
+	for {
+		t, ok, err := lexer.nextToken()
+		if err != nil {
+			return tokens, err
+		}
+		if !ok {
+			break
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, nil
+}
+
+// nextToken skips whitespace and comments and returns the next token, or
+// false at the end of input.
+func (lexer *Lexer) nextToken() (token.Token, bool, error) {
 	for lexer.current < lexer.length {
 		c := lexer.peek()
-		if c == "(" {
-			c = lexer.consume()
-			r := token.Token{TokenType: token.LB, Lexeme: c, Line: 1}
-			tokens = append(tokens, r)
-		} else if c == ")" {
-			c = lexer.consume()
-			r := token.Token{TokenType: token.RB, Lexeme: c, Line: 1}
-			tokens = append(tokens, r)
-		} else if isDigit(c) {
+		pos := lexer.pos()
+		if c == '(' {
+			lexer.consume()
+			return token.Token{TokenType: token.LB, Lexeme: "(", Pos: pos}, true, nil
+		} else if c == ')' {
+			lexer.consume()
+			return token.Token{TokenType: token.RB, Lexeme: ")", Pos: pos}, true, nil
+		} else if lexer.startsNumber() {
 			t, err := lexer.consumeNumber()
-			if err != nil {
-				return tokens, err
-			}
-			tokens = append(tokens, t)
-		} else if c == "\"" {
+			return t, err == nil, err
+		} else if c == '"' {
 			t, err := lexer.consumeString()
-			if err != nil {
-				return tokens, err
+			return t, err == nil, err
+		} else if c == '\'' {
+			lexer.consume()
+			return token.Token{TokenType: token.TICK, Lexeme: "'", Pos: pos}, true, nil
+		} else if c == '`' {
+			lexer.consume()
+			return token.Token{TokenType: token.BACKTICK, Lexeme: "`", Pos: pos}, true, nil
+		} else if lexer.lookingAt(",@") {
+			lexer.consume()
+			lexer.consume()
+			return token.Token{TokenType: token.COMMA_AT, Lexeme: ",@", Pos: pos}, true, nil
+		} else if c == ',' {
+			lexer.consume()
+			return token.Token{TokenType: token.COMMA, Lexeme: ",", Pos: pos}, true, nil
+		} else if unicode.IsSpace(c) {
+			lexer.consume()
+		} else if c == ';' {
+			lexer.skipLineComment()
+		} else if lexer.lookingAt("#r\"") {
+			t, err := lexer.consumeRawString()
+			return t, err == nil, err
+		} else if lexer.lookingAt("#|") {
+			if err := lexer.skipBlockComment(); err != nil {
+				return token.Token{}, false, err
 			}
-			tokens = append(tokens, t)
-		} else if isWhitespace(c) {
-			lexer.current++
-		} else {
-			lexeme := lexer.consumeLexeme()
-			if lexeme == "set" {
-				tokens = append(tokens, token.Token{TokenType: token.SET, Lexeme: lexeme, Line: lexer.line})
-			} else if lexeme == "if" {
-				tokens = append(tokens, token.Token{TokenType: token.IF, Lexeme: lexeme, Line: lexer.line})
-			} else if lexeme == "while" {
-				tokens = append(tokens, token.Token{TokenType: token.WHILE, Lexeme: lexeme, Line: lexer.line})
-			} else if lexeme == "defn" {
-				tokens = append(tokens, token.Token{TokenType: token.DEFN, Lexeme: lexeme, Line: lexer.line})
-			} else if lexeme == "nil" {
-				tokens = append(tokens, token.Token{TokenType: token.LITERAL, Lexeme: lexeme, Value: nil, Line: lexer.line})
-			} else if lexeme == "for" {
-				tokens = append(tokens, token.Token{TokenType: token.FOR, Lexeme: lexeme, Line: lexer.line})
-			} else {
-				tokens = append(tokens, token.Token{TokenType: token.KEYWORD, Lexeme: lexeme, Line: lexer.line})
+		} else if lexer.lookingAt("#_") {
+			lexer.consume()
+			lexer.consume()
+			if err := lexer.skipDatum(pos); err != nil {
+				return token.Token{}, false, err
 			}
+		} else {
+			return lexer.consumeSymbol(pos), true, nil
 		}
 	}
+	return token.Token{}, false, nil
+}
 
-	return tokens, nil
+// literals are the symbols that stand for constant values.
+var literals = map[string]interface{}{
+	"nil":   nil,
+	"true":  true,
+	"false": false,
+	"#t":    true,
+	"#f":    false,
 }
 
-func (lexer *Lexer) peek() string {
-	return lexer.source[lexer.current : lexer.current+1]
+func (lexer *Lexer) consumeSymbol(pos token.Pos) token.Token {
+	lexeme := lexer.consumeLexeme()
+	if val, ok := literals[lexeme]; ok {
+		return token.Token{TokenType: token.LITERAL, Lexeme: lexeme, Value: val, Pos: pos}
+	}
+	return token.Token{TokenType: token.Lookup(lexeme), Lexeme: lexeme, Pos: pos}
 }
 
-func (lexer *Lexer) consume() string {
-	s := lexer.source[lexer.current : lexer.current+1]
-	lexer.current++
-	return s
+func (lexer *Lexer) lookingAt(s string) bool {
+	prefix := []rune(s)
+	if lexer.current+len(prefix) > lexer.length {
+		return false
+	}
+	return string(lexer.source[lexer.current:lexer.current+len(prefix)]) == s
 }
 
-func endsToken(c string) bool {
-	token_enders := []string{"(", ")", "\n", "\t", " "}
-	for _, cc := range token_enders {
-		if c == cc {
-			return true
+// skipLineComment skips from a ';' up to the end of the line.
+func (lexer *Lexer) skipLineComment() {
+	for lexer.current < lexer.length && lexer.peek() != '\n' {
+		lexer.consume()
+	}
+}
+
+// skipBlockComment skips a #| ... |# comment. Block comments nest.
+func (lexer *Lexer) skipBlockComment() error {
+	pos := lexer.pos()
+	depth := 0
+	for lexer.current < lexer.length {
+		if lexer.lookingAt("#|") {
+			lexer.consume()
+			lexer.consume()
+			depth++
+		} else if lexer.lookingAt("|#") {
+			lexer.consume()
+			lexer.consume()
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		} else {
+			lexer.consume()
 		}
 	}
-	return false
+	return token.Errorf(pos, "error while lexing. reached end of input in block comment")
 }
 
-func isWhitespace(c string) bool {
-	whitespace := []string{" ", "\n", "\t"}
-	for _, cc := range whitespace {
-		if c == cc {
-			return true
+// skipDatum discards the form following a #_ datum comment.
+func (lexer *Lexer) skipDatum(pos token.Pos) error {
+	t, ok, err := lexer.nextToken()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return token.Errorf(pos, "error while lexing. reached end of input after #_")
+	}
+	if t.TokenType == token.RB {
+		return token.Errorf(t.Pos, "error while lexing. expected a form after #_ but got ')'")
+	}
+	if isPrefix(t.TokenType) {
+		return lexer.skipDatum(pos)
+	}
+	if t.TokenType != token.LB {
+		return nil
+	}
+	depth := 1
+	for depth > 0 {
+		t, ok, err = lexer.nextToken()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return token.Errorf(pos, "error while lexing. reached end of input in form after #_")
 		}
+		if t.TokenType == token.LB {
+			depth++
+		} else if t.TokenType == token.RB {
+			depth--
+		}
+	}
+	return nil
+}
+
+func (lexer *Lexer) pos() token.Pos {
+	return token.Pos{File: lexer.file, Line: lexer.line, Column: lexer.current - lexer.lineStart + 1}
+}
+
+func (lexer *Lexer) peek() rune {
+	return lexer.source[lexer.current]
+}
+
+func (lexer *Lexer) consume() rune {
+	c := lexer.source[lexer.current]
+	lexer.current++
+	if c == '\n' {
+		lexer.line++
+		lexer.lineStart = lexer.current
 	}
-	return false
+	return c
+}
+
+func endsToken(c rune) bool {
+	return unicode.IsSpace(c) || strings.ContainsRune("();'`,", c)
+}
+
+func isPrefix(tt token.TokenType) bool {
+	return tt == token.TICK || tt == token.BACKTICK || tt == token.COMMA || tt == token.COMMA_AT
 }
 
 func (lexer *Lexer) consumeLexeme() string {
-	var b strings.Builder
-	var c string
+	start := lexer.current
 	for lexer.current < lexer.length && !endsToken(lexer.peek()) {
-		c = lexer.consume()
-		b.WriteString(c)
+		lexer.consume()
 	}
-	return b.String()
+	return string(lexer.source[start:lexer.current])
 }
 
 func (lexer *Lexer) consumeNumber() (token.Token, error) {
-	var b strings.Builder
-	var c string
-	for lexer.current < lexer.length && !endsToken(lexer.peek()) {
-		c = lexer.consume()
-		b.WriteString(c)
-	}
-	val, ok := strconv.ParseFloat(b.String(), 64)
-	if ok != nil {
-		return token.Token{}, fmt.Errorf("error while lexing on line %d. '%v' is not a number", lexer.line, b.String())
+	pos := lexer.pos()
+	lexeme := lexer.consumeLexeme()
+	val, err := number.Parse(lexeme)
+	if err != nil {
+		return token.Token{}, token.Errorf(pos, "error while lexing. '%v' is not a number", lexeme)
 	}
-	return token.Token{TokenType: token.LITERAL, Lexeme: b.String(), Value: val, Line: 1}, nil
+	return token.Token{TokenType: token.LITERAL, Lexeme: lexeme, Value: val, Pos: pos}, nil
 }
 
-func isDigit(c string) bool {
-	numbers := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}
-	for _, cc := range numbers {
-		if c == cc {
-			return true
-		}
+// startsNumber reports whether a number literal starts here, which is when
+// there is a digit after an optional sign and decimal point. A sign on its
+// own is a symbol.
+func (lexer *Lexer) startsNumber() bool {
+	i := lexer.current
+	if i < lexer.length && (lexer.source[i] == '+' || lexer.source[i] == '-') {
+		i++
 	}
-	return false
+	if i < lexer.length && lexer.source[i] == '.' {
+		i++
+	}
+	return i < lexer.length && isDigit(lexer.source[i])
+}
+
+// isDigit reports whether c is an ASCII digit. Digits from other scripts
+// are not accepted in numbers.
+func isDigit(c rune) bool {
+	return '0' <= c && c <= '9'
 }
 
 func (lexer *Lexer) consumeString() (token.Token, error) {
+	pos := lexer.pos()
+	start := lexer.current
 	var b strings.Builder
-	var c string
-	b.WriteString(lexer.consume()) // Consume the first quote
-	for lexer.current < lexer.length && lexer.peek() != "\"" {
-		if lexer.peek() == "\n" {
-			return token.Token{}, fmt.Errorf("error while lexing on line %d. reached end of line in string '%v'", lexer.line, b.String())
+	lexer.consume() // Consume the first quote
+	for lexer.current < lexer.length && lexer.peek() != '"' {
+		if lexer.peek() != '\\' {
+			b.WriteRune(lexer.consume())
+			continue
+		}
+		if err := lexer.consumeEscape(&b); err != nil {
+			return token.Token{}, err
 		}
-		c = lexer.consume()
-		b.WriteString(c)
 	}
 	if lexer.current == lexer.length {
-		return token.Token{}, fmt.Errorf("error while lexing on line %d. reached end of input in string '%v'", lexer.line, b.String())
+		return token.Token{}, token.Errorf(pos, "error while lexing. reached end of input in string '%v'", string(lexer.source[start:lexer.current]))
+	}
+	lexer.consume() // Consume the final quote
+
+	return token.Token{TokenType: token.LITERAL, Lexeme: string(lexer.source[start:lexer.current]), Value: b.String(), Pos: pos}, nil
+}
+
+// escapes maps the character after a backslash to the character it stands
+// for.
+var escapes = map[rune]rune{
+	'"':  '"',
+	'\\': '\\',
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+}
+
+// consumeEscape reads an escape sequence in a string, writing the character
+// it stands for to b.
+func (lexer *Lexer) consumeEscape(b *strings.Builder) error {
+	pos := lexer.pos()
+	lexer.consume() // Consume the backslash
+	if lexer.current == lexer.length {
+		return token.Errorf(pos, "error while lexing. reached end of input in escape sequence")
+	}
+	c := lexer.consume()
+	if e, ok := escapes[c]; ok {
+		b.WriteRune(e)
+		return nil
+	}
+	if c != 'u' {
+		return token.Errorf(pos, "error while lexing. invalid escape sequence '\\%c'", c)
+	}
+
+	if lexer.current == lexer.length || lexer.peek() != '{' {
+		return token.Errorf(pos, "error while lexing. expected '{' after '\\u'")
+	}
+	lexer.consume()
+	var hex strings.Builder
+	for lexer.current < lexer.length && lexer.peek() != '}' && lexer.peek() != '"' {
+		hex.WriteRune(lexer.consume())
+	}
+	if lexer.current == lexer.length || lexer.peek() != '}' {
+		return token.Errorf(pos, "error while lexing. missing '}' in unicode escape")
+	}
+	lexer.consume()
+	code, err := strconv.ParseUint(hex.String(), 16, 32)
+	if err != nil || hex.Len() > 6 || !utf8.ValidRune(rune(code)) {
+		return token.Errorf(pos, "error while lexing. invalid unicode escape '\\u{%v}'", hex.String())
+	}
+	b.WriteRune(rune(code))
+	return nil
+}
+
+// consumeRawString reads a #r"..." string, in which backslashes have no
+// special meaning.
+func (lexer *Lexer) consumeRawString() (token.Token, error) {
+	pos := lexer.pos()
+	start := lexer.current
+	lexer.consume() // Consume the #
+	lexer.consume() // Consume the r
+	lexer.consume() // Consume the first quote
+	for lexer.current < lexer.length && lexer.peek() != '"' {
+		lexer.consume()
+	}
+	if lexer.current == lexer.length {
+		return token.Token{}, token.Errorf(pos, "error while lexing. reached end of input in raw string '%v'", string(lexer.source[start:lexer.current]))
 	}
-	b.WriteString(lexer.consume()) // Consume the final quote
-	lexeme := b.String()
-	val, _ := strconv.Unquote(lexeme)
+	lexer.consume() // Consume the final quote
+	lexeme := string(lexer.source[start:lexer.current])
 
-	return token.Token{TokenType: token.LITERAL, Lexeme: lexeme, Value: val, Line: 1}, nil
+	return token.Token{TokenType: token.LITERAL, Lexeme: lexeme, Value: lexeme[3 : len(lexeme)-1], Pos: pos}, nil
 }
@@ -1,8 +1,11 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/danwhitford/danlisp/internal/number"
 	"github.com/danwhitford/danlisp/internal/token"
 )
 
@@ -18,8 +21,8 @@ func assertString(t *testing.T, expected, actual string) {
 	}
 }
 
-func assertNumber(t *testing.T, expected, actual float64) {
-	if expected != actual {
+func assertNumber(t *testing.T, expected float64, actual interface{}) {
+	if !number.Equal(expected, actual) {
 		t.Fatalf("Assertion failed. Expected '%v' but got '%v'", expected, actual)
 	}
 }
@@ -47,11 +50,11 @@ func TestBracketPair(t *testing.T) {
 }
 
 func TestKeyword(t *testing.T) {
-	input := "let"
+	input := "foo"
 	lex := NewLexer(input)
 	tokens, _ := lex.GetTokens()
 	assertType(t, token.KEYWORD, tokens[0].TokenType)
-	assertString(t, "let", tokens[0].Lexeme)
+	assertString(t, "foo", tokens[0].Lexeme)
 }
 
 func TestNumber(t *testing.T) {
@@ -60,14 +63,14 @@ func TestNumber(t *testing.T) {
 	tokens, _ := lex.GetTokens()
 	assertType(t, token.LITERAL, tokens[0].TokenType)
 	assertString(t, "123.7", tokens[0].Lexeme)
-	assertNumber(t, 123.7, tokens[0].Value.(float64))
+	assertNumber(t, 123.7, tokens[0].Value)
 }
 
 func TestErrorInNumber(t *testing.T) {
 	input := "123notanumber"
 	lex := NewLexer(input)
 	_, err := lex.GetTokens()
-	assertString(t, err.Error(), "error while lexing on line 1. '123notanumber' is not a number")
+	assertString(t, err.Error(), "1:1: error while lexing. '123notanumber' is not a number")
 }
 
 func TestString(t *testing.T) {
@@ -79,18 +82,31 @@ func TestString(t *testing.T) {
 	assertString(t, "i am the fly", tokens[0].Value.(string))
 }
 
-func TestEOLInString(t *testing.T) {
-	input := "\"i am the fly\nfly in the fly in the\""
+func TestMultiLineString(t *testing.T) {
+	input := "\"i am the fly\nfly in the fly in the\" x"
 	lex := NewLexer(input)
-	_, err := lex.GetTokens()
-	assertString(t, err.Error(), "error while lexing on line 1. reached end of line in string '\"i am the fly'")
+	tokens, err := lex.GetTokens()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	assertString(t, "i am the fly\nfly in the fly in the", tokens[0].Value.(string))
+	assertString(t, "2:24", tokens[1].Pos.String())
 }
 
 func TestEOFInString(t *testing.T) {
 	input := "\"i am the fly"
 	lex := NewLexer(input)
 	_, err := lex.GetTokens()
-	assertString(t, err.Error(), "error while lexing on line 1. reached end of input in string '\"i am the fly'")
+	assertString(t, err.Error(), "1:1: error while lexing. reached end of input in string '\"i am the fly'")
+
+	// The error points at the opening quote rather than the end of input.
+	lex = NewLexer("(prn \"abc\n(+ 1 2)")
+	_, err = lex.GetTokens()
+	var lerr *token.Error
+	if !errors.As(err, &lerr) {
+		t.Fatalf("Expected a lexing error but got %v", err)
+	}
+	assertString(t, "1:6", lerr.Pos.String())
 }
 
 func TestSeq(t *testing.T) {
@@ -147,4 +163,248 @@ func TestFor(t *testing.T) {
 	tokens, _ := lex.GetTokens()
 	assertType(t, token.LB, tokens[0].TokenType)
 	assertType(t, token.FOR, tokens[1].TokenType)
-}
\ No newline at end of file
+}
+func TestFn(t *testing.T) {
+	input := "(fn (x) x) (lambda (y) y)"
+	lex := NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	assertType(t, token.FN, tokens[1].TokenType)
+	assertType(t, token.FN, tokens[8].TokenType)
+}
+
+func TestPositions(t *testing.T) {
+	input := "(set x 5)\n  (prn \"x\"\n\tx)"
+	lex := NewFileLexer("test.dan", input)
+	tokens, _ := lex.GetTokens()
+	expected := []token.Pos{
+		{File: "test.dan", Line: 1, Column: 1},
+		{File: "test.dan", Line: 1, Column: 2},
+		{File: "test.dan", Line: 1, Column: 6},
+		{File: "test.dan", Line: 1, Column: 8},
+		{File: "test.dan", Line: 1, Column: 9},
+		{File: "test.dan", Line: 2, Column: 3},
+		{File: "test.dan", Line: 2, Column: 4},
+		{File: "test.dan", Line: 2, Column: 8},
+		{File: "test.dan", Line: 3, Column: 2},
+		{File: "test.dan", Line: 3, Column: 3},
+	}
+	for i, pos := range expected {
+		if tokens[i].Pos != pos {
+			t.Fatalf("Token %d: expected %v but got %v", i, pos, tokens[i].Pos)
+		}
+	}
+}
+
+func TestErrorPositionOnLaterLine(t *testing.T) {
+	input := "(prn 1)\n(prn 12abc)"
+	lex := NewFileLexer("test.dan", input)
+	_, err := lex.GetTokens()
+	assertString(t, "test.dan:2:6: error while lexing. '12abc' is not a number", err.Error())
+}
+
+func TestLineComment(t *testing.T) {
+	input := "; a comment\n(prn x) ; trailing\nfoo;bar"
+	lex := NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	if len(tokens) != 5 {
+		t.Fatalf("Expected 5 tokens but got %v", tokens)
+	}
+	assertType(t, token.LB, tokens[0].TokenType)
+	assertString(t, "prn", tokens[1].Lexeme)
+	assertString(t, "foo", tokens[4].Lexeme)
+	assertString(t, "3:1", tokens[4].Pos.String())
+}
+
+func TestBlockComment(t *testing.T) {
+	input := "#| a\nblock #| nested |#\ncomment |# x"
+	lex := NewLexer(input)
+	tokens, err := lex.GetTokens()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	if len(tokens) != 1 {
+		t.Fatalf("Expected 1 token but got %v", tokens)
+	}
+	assertString(t, "x", tokens[0].Lexeme)
+	assertString(t, "3:12", tokens[0].Pos.String())
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	input := "x #| never closed"
+	lex := NewLexer(input)
+	_, err := lex.GetTokens()
+	assertString(t, "1:3: error while lexing. reached end of input in block comment", err.Error())
+}
+
+func TestDatumComment(t *testing.T) {
+	input := "(+ 1 #_(prn (foo) 2) #_ 3 4)"
+	lex := NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	if len(tokens) != 5 {
+		t.Fatalf("Expected 5 tokens but got %v", tokens)
+	}
+	assertNumber(t, 1, tokens[2].Value)
+	assertNumber(t, 4, tokens[3].Value)
+	assertType(t, token.RB, tokens[4].TokenType)
+}
+
+func TestDatumCommentWithoutForm(t *testing.T) {
+	input := "(+ 1 #_)"
+	lex := NewLexer(input)
+	_, err := lex.GetTokens()
+	assertString(t, "1:8: error while lexing. expected a form after #_ but got ')'", err.Error())
+}
+
+func TestQuoteTokens(t *testing.T) {
+	input := "'x `(a ,b ,@c) (quote y)"
+	lex := NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	assertType(t, token.TICK, tokens[0].TokenType)
+	assertType(t, token.KEYWORD, tokens[1].TokenType)
+	assertType(t, token.BACKTICK, tokens[2].TokenType)
+	assertType(t, token.COMMA, tokens[5].TokenType)
+	assertType(t, token.COMMA_AT, tokens[7].TokenType)
+	assertString(t, ",@", tokens[7].Lexeme)
+	assertType(t, token.QUOTE, tokens[11].TokenType)
+}
+
+func TestDatumCommentSkipsQuotedForm(t *testing.T) {
+	input := "#_'(1 2) 3"
+	lex := NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	if len(tokens) != 1 {
+		t.Fatalf("Expected 1 token but got %v", tokens)
+	}
+	assertNumber(t, 3, tokens[0].Value)
+}
+
+func TestLet(t *testing.T) {
+	input := "(let ((a 1)) a) (let* ((b 2)) b)"
+	lex := NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	assertType(t, token.LET, tokens[1].TokenType)
+	assertType(t, token.LETSTAR, tokens[11].TokenType)
+}
+
+func TestNumberLiterals(t *testing.T) {
+	input := "42 42.0 1/3 0xff 1e9"
+	lex := NewLexer(input)
+	tokens, err := lex.GetTokens()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	expected := []string{"int64", "float64", "*big.Rat", "int64", "float64"}
+	for i, tok := range tokens {
+		assertString(t, expected[i], fmt.Sprintf("%T", tok.Value))
+	}
+
+	lex = NewLexer("1/0")
+	_, err = lex.GetTokens()
+	assertString(t, "1:1: error while lexing. '1/0' is not a number", err.Error())
+}
+
+func TestSignedNumbers(t *testing.T) {
+	input := "(- -5 +3 .5 -.25 1_000_000 -x)"
+	lex := NewLexer(input)
+	tokens, err := lex.GetTokens()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	assertType(t, token.KEYWORD, tokens[1].TokenType)
+	assertString(t, "-", tokens[1].Lexeme)
+	expected := []float64{-5, 3, 0.5, -0.25, 1000000}
+	for i, n := range expected {
+		assertType(t, token.LITERAL, tokens[i+2].TokenType)
+		assertNumber(t, n, tokens[i+2].Value)
+	}
+	assertType(t, token.KEYWORD, tokens[7].TokenType)
+	assertString(t, "-x", tokens[7].Lexeme)
+
+	lex = NewLexer("1__000")
+	_, err = lex.GetTokens()
+	assertString(t, "1:1: error while lexing. '1__000' is not a number", err.Error())
+}
+
+func TestStringEscapes(t *testing.T) {
+	input := `"say \"hi\"" "a\\b" "tab\there\nnew" "\u{e9}\u{1F600}"`
+	lex := NewLexer(input)
+	tokens, err := lex.GetTokens()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	expected := []string{`say "hi"`, `a\b`, "tab\there\nnew", "\u00e9\U0001F600"}
+	for i, e := range expected {
+		assertString(t, e, tokens[i].Value.(string))
+	}
+	assertString(t, `"say \"hi\""`, tokens[0].Lexeme)
+}
+
+func TestInvalidEscapes(t *testing.T) {
+	sources := []string{`"ab\qc"`, `"\u{110000}"`, `"\u{zz}"`, `"\u41"`, `"\u{41"`}
+	expected := []string{
+		"1:4: error while lexing. invalid escape sequence '\\q'",
+		"1:2: error while lexing. invalid unicode escape '\\u{110000}'",
+		"1:2: error while lexing. invalid unicode escape '\\u{zz}'",
+		"1:2: error while lexing. expected '{' after '\\u'",
+		"1:2: error while lexing. missing '}' in unicode escape",
+	}
+	for i, s := range sources {
+		lex := NewLexer(s)
+		_, err := lex.GetTokens()
+		if err == nil {
+			t.Fatalf("Expecting error for %v", s)
+		}
+		assertString(t, expected[i], err.Error())
+	}
+}
+
+func TestRawString(t *testing.T) {
+	input := "#r\"C:\\path\\n\" #r\"two\nlines\""
+	lex := NewLexer(input)
+	tokens, err := lex.GetTokens()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	assertString(t, `C:\path\n`, tokens[0].Value.(string))
+	assertString(t, "two\nlines", tokens[1].Value.(string))
+
+	lex = NewLexer(`#r"open`)
+	_, err = lex.GetTokens()
+	assertString(t, "1:1: error while lexing. reached end of input in raw string '#r\"open'", err.Error())
+}
+
+func TestUnicode(t *testing.T) {
+	input := "(set café \"naïve 😀\") (prn π)"
+	lex := NewLexer(input)
+	tokens, err := lex.GetTokens()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	assertString(t, "café", tokens[2].Lexeme)
+	assertString(t, "naïve 😀", tokens[3].Value.(string))
+	assertString(t, "1:11", tokens[3].Pos.String())
+	assertString(t, "1:20", tokens[4].Pos.String())
+	assertString(t, "π", tokens[7].Lexeme)
+	assertString(t, "1:27", tokens[7].Pos.String())
+
+	lex = NewLexer(" x")
+	tokens, _ = lex.GetTokens()
+	assertString(t, "x", tokens[0].Lexeme)
+}
+
+func TestBooleanLiterals(t *testing.T) {
+	input := "true false #t #f t"
+	lex := NewLexer(input)
+	tokens, err := lex.GetTokens()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	expected := []bool{true, false, true, false}
+	for i, b := range expected {
+		assertType(t, token.LITERAL, tokens[i].TokenType)
+		if tokens[i].Value != b {
+			t.Fatalf("Expected %v but got %v", b, tokens[i].Value)
+		}
+	}
+	assertType(t, token.KEYWORD, tokens[4].TokenType)
+}
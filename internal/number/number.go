@@ -0,0 +1,348 @@
+// Package number implements DanLisp's numeric tower.
+//
+// Integers are int64 values, or *big.Int once they no longer fit in 64
+// bits. Exact fractions are *big.Rat and inexact numbers are float64.
+// Operations on mixed types convert both operands to the more general of
+// the two, in that order, and always return the simplest representation of
+// their result, so an integer that fits in an int64 is never a *big.Int and
+// a fraction with a denominator of 1 is an integer.
+package number
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrDivideByZero is returned when an exact number is divided by zero.
+var ErrDivideByZero = errors.New("division by zero")
+
+const (
+	integer = iota
+	bigInteger
+	rational
+	float
+)
+
+// IsNumber reports whether v is a number.
+func IsNumber(v interface{}) bool {
+	switch v.(type) {
+	case int64, *big.Int, *big.Rat, float64:
+		return true
+	}
+	return false
+}
+
+// IsInteger reports whether v is an integer of any size.
+func IsInteger(v interface{}) bool {
+	switch v.(type) {
+	case int64, *big.Int:
+		return true
+	}
+	return false
+}
+
+// Parse reads a number literal, which may have a sign. Integers may be
+// written in decimal or with a 0x, 0o or 0b prefix, fractions as 1/3 and
+// floats with a decimal point or exponent. Digits may be separated by
+// underscores, as in 1_000_000.
+func Parse(s string) (interface{}, error) {
+	digits := strings.TrimLeft(s, "+-")
+	lower := strings.ToLower(digits)
+	prefixed := strings.HasPrefix(lower, "0x") || strings.HasPrefix(lower, "0o") || strings.HasPrefix(lower, "0b")
+	s, ok := stripSeparators(s, prefixed)
+	if !ok {
+		return nil, strconv.ErrSyntax
+	}
+	digits = strings.TrimLeft(s, "+-")
+	switch {
+	case prefixed:
+		n, ok := new(big.Int).SetString(s, 0)
+		if !ok {
+			return nil, strconv.ErrSyntax
+		}
+		return Normalize(n), nil
+	case strings.Contains(digits, "/"):
+		parts := strings.SplitN(s, "/", 2)
+		num, ok := new(big.Int).SetString(parts[0], 10)
+		if !ok {
+			return nil, strconv.ErrSyntax
+		}
+		den, ok := new(big.Int).SetString(parts[1], 10)
+		if !ok || strings.ContainsAny(parts[1], "+-") {
+			return nil, strconv.ErrSyntax
+		}
+		if den.Sign() == 0 {
+			return nil, ErrDivideByZero
+		}
+		return Normalize(new(big.Rat).SetFrac(num, den)), nil
+	case strings.ContainsAny(lower, ".e"):
+		return strconv.ParseFloat(s, 64)
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, strconv.ErrSyntax
+	}
+	return Normalize(n), nil
+}
+
+// stripSeparators removes underscores from between digits, failing if one
+// is anywhere else. Prefixed literals may use hex digits.
+func stripSeparators(s string, prefixed bool) (string, bool) {
+	if !strings.Contains(s, "_") {
+		return s, true
+	}
+	isDigit := func(c byte) bool {
+		return '0' <= c && c <= '9' || prefixed && ('a' <= c && c <= 'f' || 'A' <= c && c <= 'F')
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '_' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i == 0 || i == len(s)-1 || !isDigit(s[i-1]) || !isDigit(s[i+1]) {
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// Normalize returns the simplest representation of a number.
+func Normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case *big.Int:
+		if n.IsInt64() {
+			return n.Int64()
+		}
+	case *big.Rat:
+		if n.IsInt() {
+			return Normalize(new(big.Int).Set(n.Num()))
+		}
+	}
+	return v
+}
+
+func rank(v interface{}) int {
+	switch v.(type) {
+	case int64:
+		return integer
+	case *big.Int:
+		return bigInteger
+	case *big.Rat:
+		return rational
+	}
+	return float
+}
+
+// rankOf returns the rank both operands are converted to.
+func rankOf(a, b interface{}) int {
+	if r := rank(b); r > rank(a) {
+		return r
+	}
+	return rank(a)
+}
+
+func toBig(v interface{}) *big.Int {
+	switch n := v.(type) {
+	case int64:
+		return big.NewInt(n)
+	case *big.Int:
+		return n
+	}
+	return nil
+}
+
+func toRat(v interface{}) *big.Rat {
+	switch n := v.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(n)
+	case *big.Int:
+		return new(big.Rat).SetInt(n)
+	case *big.Rat:
+		return n
+	}
+	return nil
+}
+
+// ToFloat converts a number to the nearest float64.
+func ToFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(n).Float64()
+		return f
+	case *big.Rat:
+		f, _ := n.Float64()
+		return f
+	case float64:
+		return n
+	}
+	return math.NaN()
+}
+
+// ToBig converts an integer to a *big.Int, which must not be modified.
+func ToBig(v interface{}) *big.Int {
+	return toBig(v)
+}
+
+func Add(a, b interface{}) interface{} {
+	switch rankOf(a, b) {
+	case integer:
+		x, y := a.(int64), b.(int64)
+		if c := x + y; (c > x) == (y > 0) {
+			return c
+		}
+		fallthrough
+	case bigInteger:
+		return Normalize(new(big.Int).Add(toBig(a), toBig(b)))
+	case rational:
+		return Normalize(new(big.Rat).Add(toRat(a), toRat(b)))
+	}
+	return ToFloat(a) + ToFloat(b)
+}
+
+func Sub(a, b interface{}) interface{} {
+	switch rankOf(a, b) {
+	case integer:
+		x, y := a.(int64), b.(int64)
+		if c := x - y; (c < x) == (y > 0) {
+			return c
+		}
+		fallthrough
+	case bigInteger:
+		return Normalize(new(big.Int).Sub(toBig(a), toBig(b)))
+	case rational:
+		return Normalize(new(big.Rat).Sub(toRat(a), toRat(b)))
+	}
+	return ToFloat(a) - ToFloat(b)
+}
+
+func Mul(a, b interface{}) interface{} {
+	switch rankOf(a, b) {
+	case integer:
+		x, y := a.(int64), b.(int64)
+		if x == 0 || y == 0 {
+			return int64(0)
+		}
+		c := x * y
+		if c/y == x && !(x == -1 && y == math.MinInt64) && !(y == -1 && x == math.MinInt64) {
+			return c
+		}
+		fallthrough
+	case bigInteger:
+		return Normalize(new(big.Int).Mul(toBig(a), toBig(b)))
+	case rational:
+		return Normalize(new(big.Rat).Mul(toRat(a), toRat(b)))
+	}
+	return ToFloat(a) * ToFloat(b)
+}
+
+// Div divides a by b. Dividing integers gives a fraction unless the
+// division is exact.
+func Div(a, b interface{}) (interface{}, error) {
+	r := rankOf(a, b)
+	if r == float {
+		return ToFloat(a) / ToFloat(b), nil
+	}
+	if Sign(b) == 0 {
+		return nil, ErrDivideByZero
+	}
+	if r == integer {
+		x, y := a.(int64), b.(int64)
+		if x%y == 0 && !(x == math.MinInt64 && y == -1) {
+			return x / y, nil
+		}
+	}
+	return Normalize(new(big.Rat).Quo(toRat(a), toRat(b))), nil
+}
+
+// Mod returns the remainder of dividing a by b, truncating the quotient
+// towards zero so the result has the sign of a.
+func Mod(a, b interface{}) (interface{}, error) {
+	r := rankOf(a, b)
+	if r == float {
+		return math.Mod(ToFloat(a), ToFloat(b)), nil
+	}
+	if Sign(b) == 0 {
+		return nil, ErrDivideByZero
+	}
+	switch r {
+	case integer:
+		return a.(int64) % b.(int64), nil
+	case bigInteger:
+		return Normalize(new(big.Int).Rem(toBig(a), toBig(b))), nil
+	}
+	q := new(big.Rat).Quo(toRat(a), toRat(b))
+	trunc := new(big.Rat).SetInt(new(big.Int).Quo(q.Num(), q.Denom()))
+	return Normalize(new(big.Rat).Sub(toRat(a), trunc.Mul(trunc, toRat(b)))), nil
+}
+
+// Sign returns -1, 0 or 1 depending on the sign of v.
+func Sign(v interface{}) int {
+	switch n := v.(type) {
+	case int64:
+		switch {
+		case n < 0:
+			return -1
+		case n > 0:
+			return 1
+		}
+		return 0
+	case *big.Int:
+		return n.Sign()
+	case *big.Rat:
+		return n.Sign()
+	}
+	f := ToFloat(v)
+	switch {
+	case f < 0:
+		return -1
+	case f > 0:
+		return 1
+	}
+	return 0
+}
+
+// Compare returns -1, 0 or 1 as a is less than, equal to or greater than b.
+// It reports false if the numbers are unordered because one is NaN.
+func Compare(a, b interface{}) (int, bool) {
+	switch rankOf(a, b) {
+	case integer:
+		x, y := a.(int64), b.(int64)
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case bigInteger:
+		return toBig(a).Cmp(toBig(b)), true
+	case rational:
+		return toRat(a).Cmp(toRat(b)), true
+	}
+	x, y := ToFloat(a), ToFloat(b)
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	case x == y:
+		return 0, true
+	}
+	return 0, false
+}
+
+// Equal reports whether two numbers have the same value, whatever their
+// representation.
+func Equal(a, b interface{}) bool {
+	c, ok := Compare(a, b)
+	return ok && c == 0
+}
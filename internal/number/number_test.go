@@ -0,0 +1,114 @@
+package number
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	sources := []string{"42", "42.0", "1/3", "4/2", "0xff", "0b101", "0o17", "1e9", "9223372036854775808", "-7", "+7", ".5", "-1/3", "1_000_000", "0xff_ff", "1_000.5"}
+	expected := []string{"int64 42", "float64 42", "*big.Rat 1/3", "int64 2", "int64 255", "int64 5", "int64 15", "float64 1e+09", "*big.Int 9223372036854775808", "int64 -7", "int64 7", "float64 0.5", "*big.Rat -1/3", "int64 1000000", "int64 65535", "float64 1000.5"}
+	for i, s := range sources {
+		val, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Not expecting error for %v but got %v", s, err)
+		}
+		if got := fmt.Sprintf("%T %v", val, val); got != expected[i] {
+			t.Fatalf("Expected %v for %v but got %v", expected[i], s, got)
+		}
+	}
+
+	for _, s := range []string{"12abc", "1/0", "1/-2", "0xfg", "1.2.3", "_1", "1_", "1__0", "1_.5", "1_e5"} {
+		if _, err := Parse(s); err == nil {
+			t.Fatalf("Expecting error for %v", s)
+		}
+	}
+}
+
+func TestOverflowPromotesToBig(t *testing.T) {
+	max := int64(math.MaxInt64)
+	sum := Add(max, int64(1))
+	if _, ok := sum.(*big.Int); !ok {
+		t.Fatalf("Expected a *big.Int but got %T", sum)
+	}
+	if back := Sub(sum, int64(1)); back != max {
+		t.Fatalf("Expected %v back as an int64 but got %T %v", max, back, back)
+	}
+	product := Mul(int64(math.MinInt64), int64(-1))
+	if fmt.Sprint(product) != "9223372036854775808" {
+		t.Fatalf("Expected MinInt64 * -1 to promote but got %v", product)
+	}
+	quotient, _ := Div(int64(math.MinInt64), int64(-1))
+	if fmt.Sprint(quotient) != "9223372036854775808" {
+		t.Fatalf("Expected MinInt64 / -1 to promote but got %v", quotient)
+	}
+}
+
+func TestContagion(t *testing.T) {
+	third, _ := Parse("1/3")
+	cases := []struct {
+		val      interface{}
+		expected string
+	}{
+		{Add(int64(1), int64(2)), "int64 3"},
+		{Add(int64(1), third), "*big.Rat 4/3"},
+		{Mul(third, int64(3)), "int64 1"},
+		{Add(third, 0.5), "float64 0.8333333333333333"},
+		{Add(int64(1), 2.0), "float64 3"},
+	}
+	for _, c := range cases {
+		if got := fmt.Sprintf("%T %v", c.val, c.val); got != c.expected {
+			t.Fatalf("Expected %v but got %v", c.expected, got)
+		}
+	}
+}
+
+func TestDivMod(t *testing.T) {
+	cases := []struct {
+		op       func(a, b interface{}) (interface{}, error)
+		a, b     interface{}
+		expected string
+	}{
+		{Div, int64(10), int64(4), "*big.Rat 5/2"},
+		{Div, int64(10), int64(5), "int64 2"},
+		{Div, int64(1), 0.0, "float64 +Inf"},
+		{Mod, int64(-7), int64(2), "int64 -1"},
+		{Mod, 7.5, int64(2), "float64 1.5"},
+	}
+	for _, c := range cases {
+		val, err := c.op(c.a, c.b)
+		if err != nil {
+			t.Fatalf("Not expecting error but got %v", err)
+		}
+		if got := fmt.Sprintf("%T %v", val, val); got != c.expected {
+			t.Fatalf("Expected %v but got %v", c.expected, got)
+		}
+	}
+
+	half, _ := Parse("7/2")
+	rem, _ := Mod(half, int64(2))
+	if fmt.Sprint(rem) != "3/2" {
+		t.Fatalf("Expected 3/2 but got %v", rem)
+	}
+	if _, err := Div(int64(1), int64(0)); err != ErrDivideByZero {
+		t.Fatalf("Expected division by zero but got %v", err)
+	}
+	if _, err := Mod(int64(1), int64(0)); err != ErrDivideByZero {
+		t.Fatalf("Expected division by zero but got %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	third, _ := Parse("1/3")
+	if c, _ := Compare(third, 0.3); c != 1 {
+		t.Fatal("Expected 1/3 to be greater than 0.3")
+	}
+	if !Equal(int64(2), 2.0) {
+		t.Fatal("Expected 2 to equal 2.0")
+	}
+	if _, ok := Compare(math.NaN(), int64(1)); ok {
+		t.Fatal("Expected NaN to be unordered")
+	}
+}
@@ -1,8 +1,6 @@
 package parser
 
 import (
-	"fmt"
-
 	"github.com/danwhitford/danlisp/internal/expr"
 	"github.com/danwhitford/danlisp/internal/token"
 )
@@ -11,6 +9,10 @@ type Parser struct {
 	current int
 	length  int
 	source  []token.Token
+	// macros holds the names of macros defined earlier in the source and
+	// knownMacro reports those defined before parsing began.
+	macros     map[string]bool
+	knownMacro func(name string) bool
 }
 
 func NewParser(tokens []token.Token) Parser {
@@ -18,9 +20,21 @@ func NewParser(tokens []token.Token) Parser {
 		current: 0,
 		length:  len(tokens),
 		source:  tokens,
+		macros:  map[string]bool{},
 	}
 }
 
+// KnownMacros tells the parser which names were bound to macros before the
+// source was read, such as by earlier input to the same interpreter.
+// Arguments to a macro are read as data when they don't parse as code.
+func (parser *Parser) KnownMacros(isMacro func(name string) bool) {
+	parser.knownMacro = isMacro
+}
+
+func (parser *Parser) isMacro(name string) bool {
+	return parser.macros[name] || (parser.knownMacro != nil && parser.knownMacro(name))
+}
+
 func (parser *Parser) GetExpressions() ([]expr.Expr, error) {
 	exprs := []expr.Expr{}
 
@@ -35,68 +49,250 @@ func (parser *Parser) GetExpressions() ([]expr.Expr, error) {
 	return exprs, nil
 }
 
-// TODO make this switch
+// GetData reads every form as quoted data rather than code.
+func (parser *Parser) GetData() ([]interface{}, error) {
+	data := []interface{}{}
+
+	for parser.current < parser.length {
+		datum, err := parser.consumeDatum()
+		if err != nil {
+			return data, err
+		}
+		data = append(data, datum)
+	}
+
+	return data, nil
+}
+
 func (parser *Parser) getExpression() (expr.Expr, error) {
+	if parser.current >= parser.length {
+		return nil, token.Errorf(parser.lastPos(), "parse error. unexpected end of input")
+	}
 	switch parser.peek().TokenType {
 	case token.LB:
-		if parser.next().TokenType == token.SET {
+		if parser.current+1 >= parser.length {
+			return nil, token.Errorf(parser.peek().Pos, "parse error. missing ')' to close sequence")
+		}
+		switch parser.next().TokenType {
+		case token.SET:
 			return parser.consumeSet()
-		} else if parser.next().TokenType == token.IF {
+		case token.IF:
 			return parser.consumeIf()
-		} else if parser.next().TokenType == token.WHILE {
+		case token.WHILE:
 			return parser.consumeWhile()
-		} else if parser.next().TokenType == token.DEFN {
+		case token.DEFN:
 			return parser.consumeDefun()
-		} else if parser.next().TokenType == token.FOR {
+		case token.DEFMACRO:
+			return parser.consumeDefmacro()
+		case token.FOR:
 			return parser.consumeFor()
-		} else {
+		case token.FN:
+			return parser.consumeFn()
+		case token.COND:
+			return parser.consumeCond()
+		case token.WHEN:
+			return parser.consumeWhen()
+		case token.UNLESS:
+			return parser.consumeUnless()
+		case token.DO:
+			return parser.consumeDo()
+		case token.RETURN:
+			return parser.consumeReturn()
+		case token.BREAK:
+			return parser.consumeBreak()
+		case token.CONTINUE:
+			return parser.consumeContinue()
+		case token.TRY:
+			return parser.consumeTry()
+		case token.AND:
+			return parser.consumeAnd()
+		case token.OR:
+			return parser.consumeOr()
+		case token.THROW:
+			return parser.consumeThrow()
+		case token.LET, token.LETSTAR:
+			return parser.consumeLet()
+		case token.QUOTE:
+			return parser.consumeQuoteForm()
+		case token.QUASIQUOTE:
+			return parser.consumeQuasiquoteForm()
+		case token.UNQUOTE, token.UNQUOTE_SPLICING:
+			return nil, token.Errorf(parser.peek().Pos, "parse error. %v outside of quasiquote", parser.next().Lexeme)
+		default:
 			return parser.consumeSeq()
 		}
-	case token.KEYWORD:
-		return parser.consumeKeyword()
-	default:
+	case token.RB:
+		return nil, token.Errorf(parser.peek().Pos, "parse error. unexpected ')'")
+	case token.TICK:
+		return parser.consumeQuote()
+	case token.BACKTICK:
+		return parser.consumeQuasiquote()
+	case token.COMMA, token.COMMA_AT:
+		return nil, token.Errorf(parser.peek().Pos, "parse error. '%v' outside of quasiquote", parser.peek().Lexeme)
+	case token.LITERAL:
 		return parser.consumeAtom()
+	default:
+		t := parser.peek()
+		if t.IsSymbol() {
+			return parser.consumeKeyword()
+		}
+		return nil, token.Errorf(t.Pos, "parse error. unexpected '%v'", t.Lexeme)
 	}
 }
 
 func (parser *Parser) consumeDefun() (expr.Defn, error) {
-	// TODO Make a consumeExpected func
-	parser.consume() // Consume the LB
-	parser.consume() // Consume the defun
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the defun
 
-	fnName := parser.consume()
-	if fnName.TokenType != token.KEYWORD {
-		return expr.Defn{}, fmt.Errorf("expected keyword but got %v", fnName)
+	fnName, err := parser.expect(token.KEYWORD, "function name")
+	if err != nil {
+		return expr.Defn{}, err
 	}
-	fnSymb := expr.Symbol{Name: fnName.Lexeme}
+	fnSymb := expr.Symbol{Name: fnName.Lexeme, Pos: fnName.Pos}
 
-	parser.consume() // Consume the LB for arglist
-	argList := []expr.Symbol{}
+	argList, err := parser.consumeArglist()
+	if err != nil {
+		return expr.Defn{}, err
+	}
+	body, err := parser.consumeBody(lb, "function body")
+	if err != nil {
+		return expr.Defn{}, err
+	}
+
+	return expr.Defn{Name: fnSymb, Arglist: argList, Body: body, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeDefmacro() (expr.Defmacro, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the defmacro
+
+	name, err := parser.expect(token.KEYWORD, "macro name")
+	if err != nil {
+		return expr.Defmacro{}, err
+	}
+	argList, err := parser.consumeArglist()
+	if err != nil {
+		return expr.Defmacro{}, err
+	}
+	body, err := parser.consumeBody(lb, "macro body")
+	if err != nil {
+		return expr.Defmacro{}, err
+	}
+
+	parser.macros[name.Lexeme] = true
+	return expr.Defmacro{Name: expr.Symbol{Name: name.Lexeme, Pos: name.Pos}, Arglist: argList, Body: body, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeFn() (expr.Fn, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the fn
+
+	argList, err := parser.consumeArglist()
+	if err != nil {
+		return expr.Fn{}, err
+	}
+	body, err := parser.consumeBody(lb, "function body")
+	if err != nil {
+		return expr.Fn{}, err
+	}
+
+	return expr.Fn{Arglist: argList, Body: body, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeArglist() (expr.Arglist, error) {
+	argList := expr.Arglist{Required: []expr.Symbol{}}
+	lb, err := parser.expect(token.LB, "'(' to start argument list")
+	if err != nil {
+		return argList, err
+	}
+
+	optional := false
 	for parser.current < parser.length && parser.peek().TokenType != token.RB {
 		a := parser.consume()
-		if a.TokenType != token.KEYWORD {
-			return expr.Defn{}, fmt.Errorf("arguments must be symbols but got %v", a)
+		if a.TokenType == token.KEYWORD && a.Lexeme == "&optional" {
+			if optional || argList.Rest != nil {
+				return argList, token.Errorf(a.Pos, "parse error. unexpected &optional in argument list")
+			}
+			optional = true
+			continue
+		}
+		if a.TokenType == token.KEYWORD && a.Lexeme == "&rest" {
+			if parser.current >= parser.length || !parser.peek().IsSymbol() {
+				return argList, token.Errorf(a.Pos, "parse error. &rest must be followed by a symbol")
+			}
+			r := parser.consume()
+			argList.Rest = &expr.Symbol{Name: r.Lexeme, Pos: r.Pos}
+			if parser.current < parser.length && parser.peek().TokenType != token.RB {
+				return argList, token.Errorf(parser.peek().Pos, "parse error. &rest parameter must be last in argument list")
+			}
+			continue
+		}
+		if optional {
+			opt, err := parser.consumeOptional(a)
+			if err != nil {
+				return argList, err
+			}
+			argList.Optional = append(argList.Optional, opt)
+			continue
+		}
+		if !a.IsSymbol() {
+			return argList, token.Errorf(a.Pos, "parse error. arguments must be symbols but got '%v'", a.Lexeme)
 		}
-		argList = append(argList, expr.Symbol{Name: a.Lexeme})
+		argList.Required = append(argList.Required, expr.Symbol{Name: a.Lexeme, Pos: a.Pos})
+	}
+	if parser.current == parser.length {
+		return argList, token.Errorf(lb.Pos, "parse error. missing ')' to close argument list")
 	}
 	parser.consume() // Consume the RB after arglist
+	return argList, nil
+}
+
+// consumeOptional reads an optional parameter, which is either a bare symbol
+// or a (symbol default) pair. The first token has already been consumed.
+func (parser *Parser) consumeOptional(first token.Token) (expr.Optional, error) {
+	if first.IsSymbol() {
+		return expr.Optional{Var: expr.Symbol{Name: first.Lexeme, Pos: first.Pos}}, nil
+	}
+	if first.TokenType != token.LB {
+		return expr.Optional{}, token.Errorf(first.Pos, "parse error. arguments must be symbols but got '%v'", first.Lexeme)
+	}
+	n, err := parser.expect(token.KEYWORD, "symbol to start optional argument")
+	if err != nil {
+		return expr.Optional{}, err
+	}
+	name := expr.Symbol{Name: n.Lexeme, Pos: n.Pos}
+	def, err := parser.getExpression()
+	if err != nil {
+		return expr.Optional{}, err
+	}
+	if parser.current >= parser.length || parser.peek().TokenType != token.RB {
+		return expr.Optional{}, token.Errorf(first.Pos, "parse error. optional argument '%v' should be (name default)", name.Name)
+	}
+	parser.consume() // Consume the RB
+	return expr.Optional{Var: name, Default: def}, nil
+}
 
+// consumeBody reads expressions up to and including the closing bracket of
+// the form opened by lb.
+func (parser *Parser) consumeBody(lb token.Token, form string) ([]expr.Expr, error) {
 	body := []expr.Expr{}
 	for parser.current < parser.length && parser.peek().TokenType != token.RB {
 		e, err := parser.getExpression()
 		if err != nil {
-			return expr.Defn{}, err
+			return nil, err
 		}
 		body = append(body, e)
 	}
+	if parser.current == parser.length {
+		return nil, token.Errorf(lb.Pos, "parse error. missing ')' to close %v", form)
+	}
 	parser.consume() // Consume the RB after function body
-
-	return expr.Defn{Name: fnSymb, Arglist: argList, Body: body}, nil
+	return body, nil
 }
 
 func (parser *Parser) consumeFor() (expr.For, error) {
-	parser.consume() // Consume the LB
-	parser.consume() // Consume the for
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the for
 
 	init, err := parser.getExpression()
 	if err != nil {
@@ -110,98 +306,440 @@ func (parser *Parser) consumeFor() (expr.For, error) {
 	if err != nil {
 		return expr.For{}, err
 	}
-	body := []expr.Expr{}
-	for parser.current < parser.length && parser.peek().TokenType != token.RB {
-		e, err := parser.getExpression()
-		if err != nil {
-			return expr.For{}, err
-		}
-		body = append(body, e)
+	body, err := parser.consumeBody(lb, "for")
+	if err != nil {
+		return expr.For{}, err
 	}
-	parser.consume() // Consume the RB
 
-	return expr.For{Initialiser: init, Cond: cond, Step: step, Body: body}, nil
+	return expr.For{Initialiser: init, Cond: cond, Step: step, Body: body, Pos: lb.Pos}, nil
 }
 
 func (parser *Parser) consumeWhile() (expr.While, error) {
-	parser.consume() // Consume the LB
-	parser.consume() // Consume the while
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the while
 
 	cond, cerr := parser.getExpression()
 	if cerr != nil {
 		return expr.While{}, cerr
 	}
 
-	body := []expr.Expr{}
+	body, err := parser.consumeBody(lb, "while")
+	if err != nil {
+		return expr.While{}, err
+	}
+	return expr.While{Cond: cond, Body: body, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeLet() (expr.Let, error) {
+	lb := parser.consume() // Consume the LB
+	kw := parser.consume() // Consume the let or let*
+
+	open, err := parser.expect(token.LB, "'(' to start bindings")
+	if err != nil {
+		return expr.Let{}, err
+	}
+	bindings := []expr.Binding{}
 	for parser.current < parser.length && parser.peek().TokenType != token.RB {
-		e, err := parser.getExpression()
+		blb, err := parser.expect(token.LB, "'(' to start binding")
 		if err != nil {
-			return expr.While{Cond: cond, Body: body}, err
+			return expr.Let{}, err
 		}
-		body = append(body, e)
+		name, err := parser.expect(token.KEYWORD, "symbol to bind")
+		if err != nil {
+			return expr.Let{}, err
+		}
+		val, err := parser.getExpression()
+		if err != nil {
+			return expr.Let{}, err
+		}
+		if _, err := parser.expectClose(blb, "binding"); err != nil {
+			return expr.Let{}, err
+		}
+		bindings = append(bindings, expr.Binding{Var: expr.Symbol{Name: name.Lexeme, Pos: name.Pos}, Value: val})
+	}
+	if _, err := parser.expectClose(open, "bindings"); err != nil {
+		return expr.Let{}, err
 	}
 
-	parser.consume() // Consume the RB
-	return expr.While{Cond: cond, Body: body}, nil
+	body, err := parser.consumeBody(lb, kw.Lexeme)
+	if err != nil {
+		return expr.Let{}, err
+	}
+	return expr.Let{Bindings: bindings, Body: body, Sequential: kw.TokenType == token.LETSTAR, Pos: lb.Pos}, nil
 }
 
 func (parser *Parser) consumeKeyword() (expr.Symbol, error) {
-	return expr.Symbol{Name: parser.consume().Lexeme}, nil
+	t := parser.consume()
+	return expr.Symbol{Name: t.Lexeme, Pos: t.Pos}, nil
 }
 
 func (parser *Parser) consumeAtom() (expr.Atom, error) {
-	e := expr.Atom{Value: parser.consume().Value}
+	t := parser.consume()
+	e := expr.Atom{Value: t.Value, Pos: t.Pos}
 	return e, nil
 }
 
 func (parser *Parser) consumeSeq() (expr.Seq, error) {
 	seq := []expr.Expr{}
 
-	parser.consume() // Consume the LB
+	start := parser.current
+	lb := parser.consume() // Consume the LB
 	for parser.current < parser.length && parser.peek().TokenType != token.RB {
 		e, err := parser.getExpression()
 		if err != nil {
+			if len(seq) > 0 {
+				if head, ok := seq[0].(expr.Symbol); ok && parser.isMacro(head.Name) {
+					return parser.deferSeq(start, seq[0], err)
+				}
+			}
 			return expr.Seq{Exprs: seq}, err
 		}
 		seq = append(seq, e)
 	}
 	if parser.current == parser.length {
-		return expr.Seq{}, fmt.Errorf("parse error. missing ')' to close sequence")
+		return expr.Seq{}, token.Errorf(lb.Pos, "parse error. missing ')' to close sequence")
 	}
 	parser.consume() // Consume the RB
-	return expr.Seq{Exprs: seq}, nil
+	var expansion *expr.Expansion
+	if len(seq) > 0 {
+		if _, ok := seq[0].(expr.Symbol); ok {
+			expansion = &expr.Expansion{}
+		}
+	}
+	return expr.Seq{Exprs: seq, Pos: lb.Pos, Tokens: parser.source[start:parser.current], Expansion: expansion}, nil
+}
+
+// deferSeq rereads a call to a macro starting at start whose arguments
+// failed to parse with err. A macro takes its arguments as data, so as long
+// as the sequence reads as data the error is kept on it rather than
+// returned, in case the name is no longer a macro when it is evaluated.
+func (parser *Parser) deferSeq(start int, head expr.Expr, err error) (expr.Seq, error) {
+	parser.current = start
+	if _, derr := parser.consumeDatum(); derr != nil {
+		return expr.Seq{}, err
+	}
+	lb := parser.source[start]
+	return expr.Seq{Exprs: []expr.Expr{head}, Pos: lb.Pos, Tokens: parser.source[start:parser.current], Err: err, Expansion: &expr.Expansion{}}, nil
 }
 
 func (parser *Parser) consumeSet() (expr.Set, error) {
-	parser.consume() // Consume the LB
-	parser.consume() // Consume the set
-	va := parser.consume()
-	if va.TokenType != token.KEYWORD {
-		return expr.Set{}, fmt.Errorf("parser error. trying to assign to '%v'", va.Lexeme)
-	}
-	sy := expr.Symbol{Name: va.Lexeme}
-	val, _ := parser.getExpression()
-	parser.consume() // Consume the RB
-	return expr.Set{Var: sy, Value: val}, nil
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the set
+	if parser.current >= parser.length {
+		return expr.Set{}, token.Errorf(lb.Pos, "parse error. missing ')' to close set")
+	}
+	va := parser.peek()
+	if !va.IsSymbol() {
+		return expr.Set{}, token.Errorf(va.Pos, "parse error. trying to assign to '%v'", va.Lexeme)
+	}
+	parser.consume()
+	sy := expr.Symbol{Name: va.Lexeme, Pos: va.Pos}
+	val, err := parser.getExpression()
+	if err != nil {
+		return expr.Set{}, err
+	}
+	if _, err := parser.expectClose(lb, "set"); err != nil {
+		return expr.Set{}, err
+	}
+	return expr.Set{Var: sy, Value: val, Pos: lb.Pos}, nil
 }
 
 func (parser *Parser) consumeIf() (expr.If, error) {
-	parser.consume() // Consume the LB
-	parser.consume() // Consume the if
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the if
+	if parser.atClose() {
+		return expr.If{}, token.Errorf(lb.Pos, "parse error. if expects a condition and a true branch")
+	}
 	cond, err := parser.getExpression()
 	if err != nil {
 		return expr.If{}, err
 	}
+	if parser.atClose() {
+		return expr.If{}, token.Errorf(lb.Pos, "parse error. if expects a true branch")
+	}
 	trueBranch, err := parser.getExpression()
 	if err != nil {
 		return expr.If{}, err
 	}
-	falseBranch, err := parser.getExpression()
-	if err != nil {
+	var falseBranch expr.Expr
+	if !parser.atClose() {
+		falseBranch, err = parser.getExpression()
+		if err != nil {
+			return expr.If{}, err
+		}
+	}
+	if _, err := parser.expectClose(lb, "if"); err != nil {
 		return expr.If{}, err
 	}
-	parser.consume() // Consume the RB
-	return expr.If{Cond: cond, TrueBranch: trueBranch, FalseBranch: falseBranch}, nil
+	return expr.If{Cond: cond, TrueBranch: trueBranch, FalseBranch: falseBranch, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeCond() (expr.Cond, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the cond
+
+	clauses := []expr.Clause{}
+	for parser.current < parser.length && parser.peek().TokenType != token.RB {
+		clb := parser.peek()
+		if clb.TokenType != token.LB {
+			return expr.Cond{}, token.Errorf(clb.Pos, "parse error. cond clause must be a list but got '%v'", clb.Lexeme)
+		}
+		if len(clauses) > 0 && clauses[len(clauses)-1].Test == nil {
+			return expr.Cond{}, token.Errorf(clb.Pos, "parse error. else must be the last cond clause")
+		}
+		parser.consume() // Consume the LB of the clause
+		if parser.atClose() {
+			return expr.Cond{}, token.Errorf(clb.Pos, "parse error. cond clause must have a test")
+		}
+
+		var test expr.Expr
+		if t := parser.peek(); t.TokenType == token.KEYWORD && t.Lexeme == "else" {
+			parser.consume()
+		} else {
+			var err error
+			test, err = parser.getExpression()
+			if err != nil {
+				return expr.Cond{}, err
+			}
+		}
+		body, err := parser.consumeBody(clb, "cond clause")
+		if err != nil {
+			return expr.Cond{}, err
+		}
+		if test == nil && len(body) == 0 {
+			return expr.Cond{}, token.Errorf(clb.Pos, "parse error. else clause must have a body")
+		}
+		clauses = append(clauses, expr.Clause{Test: test, Body: body})
+	}
+	if _, err := parser.expectClose(lb, "cond"); err != nil {
+		return expr.Cond{}, err
+	}
+	return expr.Cond{Clauses: clauses, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeWhen() (expr.When, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the when
+	if parser.atClose() {
+		return expr.When{}, token.Errorf(lb.Pos, "parse error. when expects a condition")
+	}
+	cond, err := parser.getExpression()
+	if err != nil {
+		return expr.When{}, err
+	}
+	body, err := parser.consumeBody(lb, "when")
+	if err != nil {
+		return expr.When{}, err
+	}
+	return expr.When{Cond: cond, Body: body, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeUnless() (expr.Unless, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the unless
+	if parser.atClose() {
+		return expr.Unless{}, token.Errorf(lb.Pos, "parse error. unless expects a condition")
+	}
+	cond, err := parser.getExpression()
+	if err != nil {
+		return expr.Unless{}, err
+	}
+	body, err := parser.consumeBody(lb, "unless")
+	if err != nil {
+		return expr.Unless{}, err
+	}
+	return expr.Unless{Cond: cond, Body: body, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeDo() (expr.Do, error) {
+	lb := parser.consume() // Consume the LB
+	kw := parser.consume() // Consume the do or progn
+	body, err := parser.consumeBody(lb, kw.Lexeme)
+	if err != nil {
+		return expr.Do{}, err
+	}
+	return expr.Do{Body: body, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeAnd() (expr.And, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the and
+	exprs, err := parser.consumeBody(lb, "and")
+	if err != nil {
+		return expr.And{}, err
+	}
+	return expr.And{Exprs: exprs, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeOr() (expr.Or, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the or
+	exprs, err := parser.consumeBody(lb, "or")
+	if err != nil {
+		return expr.Or{}, err
+	}
+	return expr.Or{Exprs: exprs, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeReturn() (expr.Return, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the return
+	var val expr.Expr
+	if !parser.atClose() {
+		var err error
+		val, err = parser.getExpression()
+		if err != nil {
+			return expr.Return{}, err
+		}
+	}
+	if _, err := parser.expectClose(lb, "return"); err != nil {
+		return expr.Return{}, err
+	}
+	return expr.Return{Value: val, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeBreak() (expr.Break, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the break
+	if _, err := parser.expectClose(lb, "break"); err != nil {
+		return expr.Break{}, err
+	}
+	return expr.Break{Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeContinue() (expr.Continue, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the continue
+	if _, err := parser.expectClose(lb, "continue"); err != nil {
+		return expr.Continue{}, err
+	}
+	return expr.Continue{Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeTry() (expr.Try, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the try
+
+	try := expr.Try{Pos: lb.Pos}
+	for !parser.atClose() {
+		clause, ok := parser.tryClause()
+		if !ok {
+			if try.Catch != nil || try.Finally != nil {
+				return expr.Try{}, token.Errorf(parser.peek().Pos, "parse error. catch and finally must come after the body of try")
+			}
+			ex, err := parser.getExpression()
+			if err != nil {
+				return expr.Try{}, err
+			}
+			try.Body = append(try.Body, ex)
+			continue
+		}
+
+		clb := parser.consume() // Consume the LB of the clause
+		parser.consume()        // Consume the catch or finally
+		switch {
+		case clause == "catch" && try.Catch != nil:
+			return expr.Try{}, token.Errorf(clb.Pos, "parse error. try can only have one catch")
+		case clause == "catch" && try.Finally != nil:
+			return expr.Try{}, token.Errorf(clb.Pos, "parse error. catch must come before finally")
+		case clause == "finally" && try.Finally != nil:
+			return expr.Try{}, token.Errorf(clb.Pos, "parse error. try can only have one finally")
+		}
+		if clause == "catch" {
+			va, err := parser.expect(token.KEYWORD, "a variable name in catch")
+			if err != nil {
+				return expr.Try{}, err
+			}
+			body, err := parser.consumeBody(clb, "catch")
+			if err != nil {
+				return expr.Try{}, err
+			}
+			try.Catch = &expr.Catch{Var: expr.Symbol{Name: va.Lexeme, Pos: va.Pos}, Body: body}
+		} else {
+			body, err := parser.consumeBody(clb, "finally")
+			if err != nil {
+				return expr.Try{}, err
+			}
+			try.Finally = body
+		}
+	}
+	if _, err := parser.expectClose(lb, "try"); err != nil {
+		return expr.Try{}, err
+	}
+	if try.Catch == nil && try.Finally == nil {
+		return expr.Try{}, token.Errorf(lb.Pos, "parse error. try expects a catch or finally clause")
+	}
+	return try, nil
+}
+
+// tryClause reports whether the next form is a catch or finally clause of a
+// try, and which.
+func (parser *Parser) tryClause() (string, bool) {
+	if parser.current+1 >= parser.length || parser.peek().TokenType != token.LB {
+		return "", false
+	}
+	t := parser.next()
+	if t.TokenType != token.KEYWORD || (t.Lexeme != "catch" && t.Lexeme != "finally") {
+		return "", false
+	}
+	return t.Lexeme, true
+}
+
+func (parser *Parser) consumeThrow() (expr.Throw, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the throw
+	if parser.atClose() {
+		return expr.Throw{}, token.Errorf(lb.Pos, "parse error. throw expects a value")
+	}
+	val, err := parser.getExpression()
+	if err != nil {
+		return expr.Throw{}, err
+	}
+	if _, err := parser.expectClose(lb, "throw"); err != nil {
+		return expr.Throw{}, err
+	}
+	return expr.Throw{Value: val, Pos: lb.Pos}, nil
+}
+
+// atClose reports whether the next token closes the current form, treating
+// the end of input the same way so the caller reports a missing ')'.
+func (parser *Parser) atClose() bool {
+	return parser.current >= parser.length || parser.peek().TokenType == token.RB
+}
+
+// expect consumes the next token, failing if it is not of the given type.
+// Expecting a KEYWORD accepts any symbol, including the names of special
+// forms.
+func (parser *Parser) expect(tt token.TokenType, what string) (token.Token, error) {
+	if parser.current >= parser.length {
+		return token.Token{}, token.Errorf(parser.lastPos(), "parse error. expected %v but reached end of input", what)
+	}
+	t := parser.peek()
+	if t.TokenType != tt && !(tt == token.KEYWORD && t.IsSymbol()) {
+		return t, token.Errorf(t.Pos, "parse error. expected %v but got '%v'", what, t.Lexeme)
+	}
+	return parser.consume(), nil
+}
+
+// expectClose consumes the ')' ending the form opened by lb.
+func (parser *Parser) expectClose(lb token.Token, form string) (token.Token, error) {
+	if parser.current >= parser.length {
+		return token.Token{}, token.Errorf(lb.Pos, "parse error. missing ')' to close %v", form)
+	}
+	t := parser.peek()
+	if t.TokenType != token.RB {
+		return t, token.Errorf(t.Pos, "parse error. too many arguments to %v", form)
+	}
+	return parser.consume(), nil
+}
+
+// lastPos is the position of the final token, used for errors at the end
+// of input.
+func (parser *Parser) lastPos() token.Pos {
+	if parser.length == 0 {
+		return token.Pos{}
+	}
+	return parser.source[parser.length-1].Pos
 }
 
 func (parser *Parser) consume() token.Token {
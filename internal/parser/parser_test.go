@@ -5,6 +5,9 @@ import (
 
 	"github.com/danwhitford/danlisp/internal/expr"
 	"github.com/danwhitford/danlisp/internal/lexer"
+	"github.com/danwhitford/danlisp/internal/number"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/symbol"
 )
 
 func assertString(t *testing.T, expected, actual string) {
@@ -13,8 +16,8 @@ func assertString(t *testing.T, expected, actual string) {
 	}
 }
 
-func assertNumber(t *testing.T, expected, actual float64) {
-	if expected != actual {
+func assertNumber(t *testing.T, expected float64, actual interface{}) {
+	if !number.Equal(expected, actual) {
 		t.Fatalf("Assertion failed. Expected '%v' but got '%v'", expected, actual)
 	}
 }
@@ -25,7 +28,7 @@ func TestNumber(t *testing.T) {
 	tokens, _ := lex.GetTokens()
 	parser := NewParser(tokens)
 	expressions, _ := parser.GetExpressions()
-	assertNumber(t, 123.7, expressions[0].(expr.Atom).Value.(float64))
+	assertNumber(t, 123.7, expressions[0].(expr.Atom).Value)
 }
 
 func TestString(t *testing.T) {
@@ -45,7 +48,7 @@ func TestSeq(t *testing.T) {
 	expressions, _ := parser.GetExpressions()
 	seq := expressions[0].(expr.Seq)
 	for i := 0; i < 6; i++ {
-		val := seq.Exprs[i].(expr.Atom).Value.(float64)
+		val := seq.Exprs[i].(expr.Atom).Value
 		assertNumber(t, float64(i), val)
 	}
 }
@@ -64,13 +67,13 @@ func TestNestedSeq(t *testing.T) {
 
 	firstNested := expressions[0].(expr.Seq).Exprs[1].(expr.Seq)
 	for i := 0; i < 3; i++ {
-		val := firstNested.Exprs[i].(expr.Atom).Value.(float64)
+		val := firstNested.Exprs[i].(expr.Atom).Value
 		assertNumber(t, float64(i), val)
 	}
 
 	secondNested := expressions[0].(expr.Seq).Exprs[2].(expr.Seq)
 	for i := 0; i < 3; i++ {
-		val := secondNested.Exprs[i].(expr.Atom).Value.(float64)
+		val := secondNested.Exprs[i].(expr.Atom).Value
 		assertNumber(t, float64(i)+3, val)
 	}
 }
@@ -81,7 +84,7 @@ func TestErrorWhenSeqNotClosed(t *testing.T) {
 	tokens, _ := lex.GetTokens()
 	parser := NewParser(tokens)
 	_, err := parser.GetExpressions()
-	assertString(t, "parse error. missing ')' to close sequence", err.Error())
+	assertString(t, "1:1: parse error. missing ')' to close sequence", err.Error())
 }
 
 func TestDefinition(t *testing.T) {
@@ -95,7 +98,7 @@ func TestDefinition(t *testing.T) {
 		t.Fatalf("Conversion to Set expression failed")
 	}
 	assertString(t, defe.Var.Name, "x")
-	assertNumber(t, 5, defe.Value.(expr.Atom).Value.(float64))
+	assertNumber(t, 5, defe.Value.(expr.Atom).Value)
 }
 
 func TestIf(t *testing.T) {
@@ -154,3 +157,461 @@ func TestFor(t *testing.T) {
 		t.Fatal("Step wasn't right")
 	}
 }
+
+func TestFn(t *testing.T) {
+	input := `(fn (a b) (prn a) (+ a b))`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, _ := parser.GetExpressions()
+	fnexpr, ok := exprs[0].(expr.Fn)
+	if !ok {
+		t.Fatalf("Conversion to Fn expression failed, got %T", exprs[0])
+	}
+	if len(fnexpr.Arglist.Required) != 2 || fnexpr.Arglist.Required[1].Name != "b" {
+		t.Fatal("Arglist wasn't right")
+	}
+	if len(fnexpr.Body) != 2 {
+		t.Fatal("Body wasn't right")
+	}
+}
+
+func TestOptionalAndRestArgs(t *testing.T) {
+	input := `(defn f (a &optional b (c 10) &rest more) a)`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, err := parser.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	args := exprs[0].(expr.Defn).Arglist
+	assertString(t, "a", args.Required[0].Name)
+	assertString(t, "b", args.Optional[0].Var.Name)
+	if args.Optional[0].Default != nil {
+		t.Fatal("Expected no default for b")
+	}
+	assertString(t, "c", args.Optional[1].Var.Name)
+	assertNumber(t, 10, args.Optional[1].Default.(expr.Atom).Value)
+	assertString(t, "more", args.Rest.Name)
+}
+
+func TestErrorWhenRestNotLast(t *testing.T) {
+	input := `(defn f (&rest more a) a)`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	_, err := parser.GetExpressions()
+	assertString(t, "1:21: parse error. &rest parameter must be last in argument list", err.Error())
+}
+
+func TestExprPositions(t *testing.T) {
+	input := "(set x 5)\n(if x\n  (prn x)\n  nil)"
+	lex := lexer.NewFileLexer("test.dan", input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, _ := parser.GetExpressions()
+	set := exprs[0].(expr.Set)
+	assertString(t, "test.dan:1:1", set.Pos.String())
+	assertString(t, "test.dan:1:6", set.Var.Pos.String())
+	ife := exprs[1].(expr.If)
+	assertString(t, "test.dan:2:1", ife.Pos.String())
+	assertString(t, "test.dan:2:5", expr.PosOf(ife.Cond).String())
+	assertString(t, "test.dan:3:3", expr.PosOf(ife.TrueBranch).String())
+	assertString(t, "test.dan:4:3", expr.PosOf(ife.FalseBranch).String())
+}
+
+func TestErrorOnUnexpectedClose(t *testing.T) {
+	input := "(+ 1 2))"
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	_, err := parser.GetExpressions()
+	assertString(t, "1:8: parse error. unexpected ')'", err.Error())
+}
+
+func TestErrorOnExtraIfBranch(t *testing.T) {
+	input := "(if t 1 2 3)"
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	_, err := parser.GetExpressions()
+	assertString(t, "1:11: parse error. too many arguments to if", err.Error())
+}
+
+func TestQuote(t *testing.T) {
+	input := `'(a "b" 3 (if nil)) (quote x) '()`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, err := parser.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	list := exprs[0].(expr.Quote).Datum.(cons.ConsCell)
+	assertString(t, "a", list.Car.(symbol.Symbol).Name)
+	assertString(t, `(a "b" 3 (if nil))`, list.String())
+	assertString(t, "x", exprs[1].(expr.Quote).Datum.(symbol.Symbol).Name)
+	if exprs[2].(expr.Quote).Datum != nil {
+		t.Fatal("Expected empty quoted list to be nil")
+	}
+}
+
+func TestNestedQuoteIsData(t *testing.T) {
+	input := `''x '(1 . 2)`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, _ := parser.GetExpressions()
+	assertString(t, "(quote x)", exprs[0].(expr.Quote).Datum.(cons.ConsCell).String())
+	assertString(t, "(1 . 2)", exprs[1].(expr.Quote).Datum.(cons.ConsCell).String())
+}
+
+func TestQuasiquote(t *testing.T) {
+	input := "`(a ,b ,@(list 1 2))"
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, err := parser.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	tmpl := exprs[0].(expr.Quasiquote).Template.(cons.ConsCell)
+	unquote := tmpl.Cdr.(cons.ConsCell).Car.(expr.Unquote)
+	assertString(t, "b", unquote.Expr.(expr.Symbol).Name)
+	splice := tmpl.Cdr.(cons.ConsCell).Cdr.(cons.ConsCell).Car.(expr.UnquoteSplicing)
+	if _, ok := splice.Expr.(expr.Seq); !ok {
+		t.Fatalf("Expected spliced expression to be a Seq but got %T", splice.Expr)
+	}
+}
+
+func TestUnquoteOutsideQuasiquote(t *testing.T) {
+	input := ",x"
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	_, err := parser.GetExpressions()
+	assertString(t, "1:1: parse error. ',' outside of quasiquote", err.Error())
+}
+
+func TestDefmacro(t *testing.T) {
+	input := "(defmacro my-when (c &rest body) `(if ,c (do ,@body) nil))"
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, err := parser.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	mac, ok := exprs[0].(expr.Defmacro)
+	if !ok {
+		t.Fatalf("Conversion to Defmacro expression failed, got %T", exprs[0])
+	}
+	assertString(t, "my-when", mac.Name.Name)
+	assertString(t, "body", mac.Arglist.Rest.Name)
+}
+
+func TestSeqWithDataArguments(t *testing.T) {
+	input := "(my-macro (if) ,x) (+ 1"
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	parser.KnownMacros(func(name string) bool { return name == "my-macro" })
+	exprs, err := parser.GetExpressions()
+	assertString(t, "1:20: parse error. missing ')' to close sequence", err.Error())
+	seq, ok := exprs[0].(expr.Seq)
+	if !ok {
+		t.Fatalf("Conversion to Seq expression failed, got %T", exprs[0])
+	}
+	assertString(t, "my-macro", seq.Exprs[0].(expr.Symbol).Name)
+	assertString(t, "1:11: parse error. if expects a condition and a true branch", seq.Err.Error())
+	if len(seq.Tokens) != 8 {
+		t.Fatalf("Expected the tokens of the whole sequence but got %v", seq.Tokens)
+	}
+
+	// Only arguments to macros are read as data.
+	for _, input := range []string{
+		"(prn \"a\")\n(defn f () (my-macro (if)))",
+		"(defmacro my-macro (x) x)\n(prn (my-macro 1) (if))",
+	} {
+		lex = lexer.NewLexer(input)
+		tokens, _ = lex.GetTokens()
+		parser = NewParser(tokens)
+		if _, err := parser.GetExpressions(); err == nil {
+			t.Fatalf("Expected a parse error for %q", input)
+		}
+	}
+	lex = lexer.NewLexer("(defmacro my-macro (x) x)\n(my-macro (if))")
+	tokens, _ = lex.GetTokens()
+	parser = NewParser(tokens)
+	if _, err := parser.GetExpressions(); err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+}
+
+func TestFromDatum(t *testing.T) {
+	input := "'(if (= x 1) (fn () \"one\") nil)"
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, _ := parser.GetExpressions()
+	datum := exprs[0].(expr.Quote).Datum
+
+	ex, err := FromDatum(datum, exprs[0].(expr.Quote).Pos)
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	ife, ok := ex.(expr.If)
+	if !ok {
+		t.Fatalf("Conversion to If expression failed, got %T", ex)
+	}
+	assertString(t, "=", ife.Cond.(expr.Seq).Exprs[0].(expr.Symbol).Name)
+	if _, ok := ife.TrueBranch.(expr.Fn); !ok {
+		t.Fatalf("Expected true branch to be Fn but got %T", ife.TrueBranch)
+	}
+	assertString(t, "1:1", ife.Pos.String())
+}
+
+func TestLet(t *testing.T) {
+	input := `(let* ((a 1) (b (+ a 1))) (prn a) b)`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, err := parser.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	let, ok := exprs[0].(expr.Let)
+	if !ok {
+		t.Fatalf("Conversion to Let expression failed, got %T", exprs[0])
+	}
+	if !let.Sequential {
+		t.Fatal("Expected let* to be sequential")
+	}
+	assertString(t, "b", let.Bindings[1].Var.Name)
+	if len(let.Body) != 2 {
+		t.Fatal("Body wasn't right")
+	}
+}
+
+func TestLetBadBinding(t *testing.T) {
+	input := `(let ((a 1 2)) a)`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	_, err := parser.GetExpressions()
+	assertString(t, "1:12: parse error. too many arguments to binding", err.Error())
+}
+
+func TestIfWithoutElse(t *testing.T) {
+	input := `(if (= 2 2) "yes") (prn "after")`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, err := parser.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	if len(exprs) != 2 {
+		t.Fatalf("Expected 2 expressions but got %d", len(exprs))
+	}
+	if exprs[0].(expr.If).FalseBranch != nil {
+		t.Fatal("Expected no false branch")
+	}
+}
+
+func TestIfShapeErrors(t *testing.T) {
+	sources := []string{`(if)`, `(if t)`, `(if t 1 2 3)`}
+	expected := []string{
+		"1:1: parse error. if expects a condition and a true branch",
+		"1:1: parse error. if expects a true branch",
+		"1:11: parse error. too many arguments to if",
+	}
+	for i, s := range sources {
+		lex := lexer.NewLexer(s)
+		tokens, _ := lex.GetTokens()
+		parser := NewParser(tokens)
+		_, err := parser.GetExpressions()
+		if err == nil {
+			t.Fatalf("Expecting error for %v", s)
+		}
+		assertString(t, expected[i], err.Error())
+	}
+}
+
+func TestCond(t *testing.T) {
+	input := `(cond ((= x 1) "one") ((= x 2) (prn x) "two") (else "many"))`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, err := parser.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	cond := exprs[0].(expr.Cond)
+	if len(cond.Clauses) != 3 {
+		t.Fatalf("Expected 3 clauses but got %d", len(cond.Clauses))
+	}
+	if len(cond.Clauses[1].Body) != 2 {
+		t.Fatal("Second clause body wasn't right")
+	}
+	if cond.Clauses[2].Test != nil {
+		t.Fatal("Expected else clause to have no test")
+	}
+}
+
+func TestCondShapeErrors(t *testing.T) {
+	sources := []string{`(cond (else 1) (t 2))`, `(cond x)`, `(cond ())`, `(cond (else))`}
+	expected := []string{
+		"1:16: parse error. else must be the last cond clause",
+		"1:7: parse error. cond clause must be a list but got 'x'",
+		"1:7: parse error. cond clause must have a test",
+		"1:7: parse error. else clause must have a body",
+	}
+	for i, s := range sources {
+		lex := lexer.NewLexer(s)
+		tokens, _ := lex.GetTokens()
+		parser := NewParser(tokens)
+		_, err := parser.GetExpressions()
+		if err == nil {
+			t.Fatalf("Expecting error for %v", s)
+		}
+		assertString(t, expected[i], err.Error())
+	}
+}
+
+func TestWhenUnlessDo(t *testing.T) {
+	input := `(when x 1 2) (unless x 3) (do 4 5) (progn 6)`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, err := parser.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	if len(exprs[0].(expr.When).Body) != 2 {
+		t.Fatal("When body wasn't right")
+	}
+	if len(exprs[1].(expr.Unless).Body) != 1 {
+		t.Fatal("Unless body wasn't right")
+	}
+	if len(exprs[2].(expr.Do).Body) != 2 {
+		t.Fatal("Do body wasn't right")
+	}
+	if len(exprs[3].(expr.Do).Body) != 1 {
+		t.Fatal("Progn body wasn't right")
+	}
+
+	lex = lexer.NewLexer(`(when)`)
+	tokens, _ = lex.GetTokens()
+	parser = NewParser(tokens)
+	_, err = parser.GetExpressions()
+	assertString(t, "1:1: parse error. when expects a condition", err.Error())
+}
+
+func TestReturnBreakContinue(t *testing.T) {
+	input := `(return) (return x) (break) (continue)`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, err := parser.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	if exprs[0].(expr.Return).Value != nil {
+		t.Fatal("Expected bare return to have no value")
+	}
+	if exprs[1].(expr.Return).Value.(expr.Symbol).Name != "x" {
+		t.Fatal("Return value wasn't right")
+	}
+	_ = exprs[2].(expr.Break)
+	_ = exprs[3].(expr.Continue)
+
+	lex = lexer.NewLexer(`(break 1)`)
+	tokens, _ = lex.GetTokens()
+	parser = NewParser(tokens)
+	_, err = parser.GetExpressions()
+	assertString(t, "1:8: parse error. too many arguments to break", err.Error())
+}
+
+func TestTry(t *testing.T) {
+	input := `(try (prn 1) (prn 2) (catch e (prn e)) (finally (prn 3)))`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, err := parser.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	try := exprs[0].(expr.Try)
+	if len(try.Body) != 2 {
+		t.Fatal("Try body wasn't right")
+	}
+	if try.Catch == nil || try.Catch.Var.Name != "e" || len(try.Catch.Body) != 1 {
+		t.Fatal("Catch clause wasn't right")
+	}
+	if len(try.Finally) != 1 {
+		t.Fatal("Finally clause wasn't right")
+	}
+}
+
+func TestTryShapeErrors(t *testing.T) {
+	sources := []string{
+		`(try (prn 1))`,
+		`(try (finally 1) (catch e 2))`,
+		`(try (catch e 1) (prn 2))`,
+		`(try (catch 1 2))`,
+		`(throw)`,
+	}
+	expected := []string{
+		"1:1: parse error. try expects a catch or finally clause",
+		"1:18: parse error. catch must come before finally",
+		"1:18: parse error. catch and finally must come after the body of try",
+		"1:13: parse error. expected a variable name in catch but got '1'",
+		"1:1: parse error. throw expects a value",
+	}
+	for i, s := range sources {
+		lex := lexer.NewLexer(s)
+		tokens, _ := lex.GetTokens()
+		parser := NewParser(tokens)
+		_, err := parser.GetExpressions()
+		if err == nil {
+			t.Fatalf("Expecting error for %v", s)
+		}
+		assertString(t, expected[i], err.Error())
+	}
+}
+
+func TestSpecialFormsOnlyAtHead(t *testing.T) {
+	input := `(defn f (cond) (do cond)) (set and or)`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, err := parser.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	defn := exprs[0].(expr.Defn)
+	assertString(t, "cond", defn.Arglist.Required[0].Name)
+	assertString(t, "cond", defn.Body[0].(expr.Do).Body[0].(expr.Symbol).Name)
+	set := exprs[1].(expr.Set)
+	assertString(t, "and", set.Var.Name)
+	assertString(t, "or", set.Value.(expr.Symbol).Name)
+}
+
+func TestAndOr(t *testing.T) {
+	input := `(and a b c) (or)`
+	lex := lexer.NewLexer(input)
+	tokens, _ := lex.GetTokens()
+	parser := NewParser(tokens)
+	exprs, err := parser.GetExpressions()
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	if len(exprs[0].(expr.And).Exprs) != 3 {
+		t.Fatal("And operands weren't right")
+	}
+	if len(exprs[1].(expr.Or).Exprs) != 0 {
+		t.Fatal("Or operands weren't right")
+	}
+}
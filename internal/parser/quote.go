@@ -0,0 +1,220 @@
+package parser
+
+import (
+	"github.com/danwhitford/danlisp/internal/expr"
+	"github.com/danwhitford/danlisp/internal/printer"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/symbol"
+	"github.com/danwhitford/danlisp/internal/token"
+)
+
+// prefixes maps reader shorthand tokens to the form they stand for.
+var prefixes = map[token.TokenType]string{
+	token.TICK:     "quote",
+	token.BACKTICK: "quasiquote",
+	token.COMMA:    "unquote",
+	token.COMMA_AT: "unquote-splicing",
+}
+
+func (parser *Parser) consumeQuote() (expr.Quote, error) {
+	tick := parser.consume() // Consume the '
+	datum, err := parser.consumeDatum()
+	if err != nil {
+		return expr.Quote{}, err
+	}
+	return expr.Quote{Datum: datum, Pos: tick.Pos}, nil
+}
+
+func (parser *Parser) consumeQuoteForm() (expr.Quote, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the quote
+	datum, err := parser.consumeDatum()
+	if err != nil {
+		return expr.Quote{}, err
+	}
+	if _, err := parser.expectClose(lb, "quote"); err != nil {
+		return expr.Quote{}, err
+	}
+	return expr.Quote{Datum: datum, Pos: lb.Pos}, nil
+}
+
+func (parser *Parser) consumeQuasiquote() (expr.Quasiquote, error) {
+	tick := parser.consume() // Consume the `
+	template, err := parser.consumeTemplate(1)
+	if err != nil {
+		return expr.Quasiquote{}, err
+	}
+	return expr.Quasiquote{Template: template, Pos: tick.Pos}, nil
+}
+
+func (parser *Parser) consumeQuasiquoteForm() (expr.Quasiquote, error) {
+	lb := parser.consume() // Consume the LB
+	parser.consume()       // Consume the quasiquote
+	template, err := parser.consumeTemplate(1)
+	if err != nil {
+		return expr.Quasiquote{}, err
+	}
+	if _, err := parser.expectClose(lb, "quasiquote"); err != nil {
+		return expr.Quasiquote{}, err
+	}
+	return expr.Quasiquote{Template: template, Pos: lb.Pos}, nil
+}
+
+// consumeDatum reads the next form as data rather than code.
+func (parser *Parser) consumeDatum() (interface{}, error) {
+	return parser.consumeTemplate(0)
+}
+
+// consumeTemplate reads the next form as data. At a quasiquote depth of one,
+// unquoted forms are parsed as expressions and embedded in the data as
+// expr.Unquote and expr.UnquoteSplicing values. A depth of zero reads plain
+// quoted data.
+func (parser *Parser) consumeTemplate(depth int) (interface{}, error) {
+	if parser.current >= parser.length {
+		return nil, token.Errorf(parser.lastPos(), "parse error. unexpected end of input")
+	}
+	t := parser.peek()
+	switch t.TokenType {
+	case token.LB:
+		return parser.consumeTemplateList(depth)
+	case token.RB:
+		return nil, token.Errorf(t.Pos, "parse error. unexpected ')'")
+	case token.LITERAL:
+		parser.consume()
+		return t.Value, nil
+	case token.TICK, token.BACKTICK, token.COMMA, token.COMMA_AT:
+		parser.consume()
+		return parser.consumePrefixed(t, prefixes[t.TokenType], depth)
+	}
+	parser.consume()
+	return symbol.Symbol{Name: t.Lexeme}, nil
+}
+
+// consumePrefixed reads the form following a quote, quasiquote, unquote or
+// unquote-splicing, whose token t has already been consumed.
+func (parser *Parser) consumePrefixed(t token.Token, name string, depth int) (interface{}, error) {
+	inner := depth
+	switch name {
+	case "quasiquote":
+		if depth > 0 {
+			inner = depth + 1
+		}
+	case "unquote", "unquote-splicing":
+		if depth == 1 {
+			e, err := parser.getExpression()
+			if err != nil {
+				return nil, err
+			}
+			if name == "unquote" {
+				return expr.Unquote{Expr: e, Pos: t.Pos}, nil
+			}
+			return expr.UnquoteSplicing{Expr: e, Pos: t.Pos}, nil
+		}
+		if depth > 0 {
+			inner = depth - 1
+		}
+	}
+	datum, err := parser.consumeTemplate(inner)
+	if err != nil {
+		return nil, err
+	}
+	return cons.FromSlice([]interface{}{symbol.Symbol{Name: name}, datum}), nil
+}
+
+func (parser *Parser) consumeTemplateList(depth int) (interface{}, error) {
+	lb := parser.consume() // Consume the LB
+
+	// (unquote x) and (unquote-splicing x) are the long forms of , and ,@
+	if parser.current < parser.length && (parser.peek().TokenType == token.UNQUOTE || parser.peek().TokenType == token.UNQUOTE_SPLICING) {
+		form := parser.consume()
+		datum, err := parser.consumePrefixed(lb, form.Lexeme, depth)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := parser.expectClose(lb, form.Lexeme); err != nil {
+			return nil, err
+		}
+		return datum, nil
+	}
+
+	items := []interface{}{}
+	var tail interface{}
+	for parser.current < parser.length && parser.peek().TokenType != token.RB {
+		if t := parser.peek(); t.TokenType == token.KEYWORD && t.Lexeme == "." {
+			if len(items) == 0 {
+				return nil, token.Errorf(t.Pos, "parse error. unexpected '.' at start of list")
+			}
+			parser.consume()
+			var err error
+			tail, err = parser.consumeTemplate(depth)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := parser.expectClose(lb, "dotted list"); err != nil {
+				return nil, err
+			}
+			return buildList(items, tail), nil
+		}
+		item, err := parser.consumeTemplate(depth)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if parser.current == parser.length {
+		return nil, token.Errorf(lb.Pos, "parse error. missing ')' to close list")
+	}
+	parser.consume() // Consume the RB
+	return buildList(items, tail), nil
+}
+
+func buildList(items []interface{}, tail interface{}) interface{} {
+	list := tail
+	for i := len(items) - 1; i >= 0; i-- {
+		list = cons.Cons(items[i], list)
+	}
+	return list
+}
+
+// FromDatum turns data, such as the result of a macro, back into an
+// expression. Every node is given the position pos.
+func FromDatum(datum interface{}, pos token.Pos) (expr.Expr, error) {
+	tokens := []token.Token{}
+	tokens = appendDatumTokens(tokens, datum, pos)
+	parser := NewParser(tokens)
+	ex, err := parser.getExpression()
+	if err != nil {
+		return nil, err
+	}
+	if parser.current < parser.length {
+		return nil, token.Errorf(pos, "parse error. could not convert %v to a single expression", datum)
+	}
+	return ex, nil
+}
+
+func appendDatumTokens(tokens []token.Token, datum interface{}, pos token.Pos) []token.Token {
+	switch v := datum.(type) {
+	case nil:
+		// nil is the empty list, which is written () in code such as
+		// an empty argument list.
+		tokens = append(tokens, token.Token{TokenType: token.LB, Lexeme: "(", Pos: pos})
+		return append(tokens, token.Token{TokenType: token.RB, Lexeme: ")", Pos: pos})
+	case symbol.Symbol:
+		return append(tokens, token.Token{TokenType: token.Lookup(v.Name), Lexeme: v.Name, Pos: pos})
+	case cons.ConsCell:
+		tokens = append(tokens, token.Token{TokenType: token.LB, Lexeme: "(", Pos: pos})
+		var rest interface{} = v
+		for rest != nil {
+			cell, ok := rest.(cons.ConsCell)
+			if !ok {
+				tokens = append(tokens, token.Token{TokenType: token.KEYWORD, Lexeme: ".", Pos: pos})
+				tokens = appendDatumTokens(tokens, rest, pos)
+				break
+			}
+			tokens = appendDatumTokens(tokens, cell.Car, pos)
+			rest = cell.Cdr
+		}
+		return append(tokens, token.Token{TokenType: token.RB, Lexeme: ")", Pos: pos})
+	}
+	return append(tokens, token.Token{TokenType: token.LITERAL, Lexeme: printer.Repr(datum), Value: datum, Pos: pos})
+}
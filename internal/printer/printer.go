@@ -0,0 +1,68 @@
+// Package printer formats DanLisp values as text.
+package printer
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/danwhitford/danlisp/internal/callable"
+)
+
+// Repr formats a value the way it would be written in source, so strings
+// are quoted. Values such as lists format themselves with a String method.
+// Functions and macros, which can't be written, are shown as #<function>,
+// #<macro> or #<builtin>.
+func Repr(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		if x {
+			return "true"
+		}
+		return "false"
+	case string:
+		return strconv.Quote(x)
+	case float64:
+		return formatFloat(x)
+	case callable.Callable:
+		return opaque("function", x.Name)
+	case callable.Macro:
+		return opaque("macro", x.Callable.Name)
+	}
+	if v != nil && reflect.TypeOf(v).Kind() == reflect.Func {
+		return "#<builtin>"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// opaque formats a value that has no written form, with its name if it
+// has one.
+func opaque(kind string, name string) string {
+	if name == "" {
+		return "#<" + kind + ">"
+	}
+	return "#<" + kind + " " + name + ">"
+}
+
+// Display formats a value for output by prn, which is as Repr except that
+// strings are written as they are.
+func Display(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return Repr(v)
+}
+
+// formatFloat always includes a decimal point or exponent so floats can be
+// told apart from integers.
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if math.IsInf(f, 0) || math.IsNaN(f) || strings.ContainsAny(s, ".e") {
+		return s
+	}
+	return s + ".0"
+}
@@ -0,0 +1,39 @@
+package printer
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/danwhitford/danlisp/internal/callable"
+)
+
+func TestRepr(t *testing.T) {
+	values := []interface{}{nil, true, false, "say \"hi\"", int64(42), 42.0, 0.5, 1e21, math.Inf(-1), big.NewRat(1, 3)}
+	expected := []string{"nil", "true", "false", `"say \"hi\""`, "42", "42.0", "0.5", "1e+21", "-Inf", "1/3"}
+	for i, v := range values {
+		if got := Repr(v); got != expected[i] {
+			t.Fatalf("Expected %v but got %v", expected[i], got)
+		}
+	}
+}
+
+func TestReprFunctions(t *testing.T) {
+	builtin := func(argv []interface{}) (interface{}, error) { return nil, nil }
+	values := []interface{}{callable.Callable{Name: "double"}, callable.Callable{}, callable.Macro{Callable: callable.Callable{Name: "my-when"}}, builtin}
+	expected := []string{"#<function double>", "#<function>", "#<macro my-when>", "#<builtin>"}
+	for i, v := range values {
+		if got := Repr(v); got != expected[i] {
+			t.Fatalf("Expected %v but got %v", expected[i], got)
+		}
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	if got := Display("hello"); got != "hello" {
+		t.Fatalf("Expected strings to be displayed unquoted but got %v", got)
+	}
+	if got := Display(nil); got != "nil" {
+		t.Fatalf("Expected nil but got %v", got)
+	}
+}
@@ -0,0 +1,183 @@
+package builtin
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/danwhitford/danlisp/internal/callable"
+	"github.com/danwhitford/danlisp/internal/number"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/errorvalue"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/symbol"
+)
+
+// Kinds of error raised by builtins, which scripts can inspect when they
+// catch an error.
+const (
+	ArityError    = "arity-error"
+	TypeError     = "type-error"
+	ValueError    = "value-error"
+	UnboundSymbol = "unbound-symbol"
+)
+
+// Error is an error with a kind. Err is the underlying error, if any.
+type Error struct {
+	Kind string
+	Msg  string
+	Err  error
+}
+
+func (err *Error) Error() string {
+	return err.Msg
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// Errorf formats an error of the given kind.
+func Errorf(kind string, format string, a ...interface{}) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, a...)}
+}
+
+// Arity checks that a builtin was given exactly n arguments.
+func Arity(name string, argv []interface{}, n int) error {
+	if len(argv) != n {
+		return Errorf(ArityError, "runtime error. '%v' expects %v but got %d", name, Arguments(n), len(argv))
+	}
+	return nil
+}
+
+// MinArity checks that a builtin was given at least n arguments.
+func MinArity(name string, argv []interface{}, n int) error {
+	if len(argv) < n {
+		return Errorf(ArityError, "runtime error. '%v' expects at least %v but got %d", name, Arguments(n), len(argv))
+	}
+	return nil
+}
+
+// Number checks that an argument is a number of any kind.
+func Number(name string, argv []interface{}, i int) (interface{}, error) {
+	if !number.IsNumber(argv[i]) {
+		return nil, ArgTypeError(name, "number", argv, i)
+	}
+	return argv[i], nil
+}
+
+// Integer checks that an argument is an integer of any size.
+func Integer(name string, argv []interface{}, i int) (interface{}, error) {
+	if !number.IsInteger(argv[i]) {
+		return nil, ArgTypeError(name, "integer", argv, i)
+	}
+	return argv[i], nil
+}
+
+// Float converts a number argument to a float64.
+func Float(name string, argv []interface{}, i int) (float64, error) {
+	n, err := Number(name, argv, i)
+	if err != nil {
+		return 0, err
+	}
+	return number.ToFloat(n), nil
+}
+
+// Int converts an integer argument to an int, failing if it is too large.
+func Int(name string, argv []interface{}, i int) (int, error) {
+	n, err := Integer(name, argv, i)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := n.(int64)
+	if !ok || v != int64(int(v)) {
+		return 0, Errorf(ValueError, "runtime error. '%v' argument %d is out of range: %v", name, i+1, n)
+	}
+	return int(v), nil
+}
+
+func String(name string, argv []interface{}, i int) (string, error) {
+	s, ok := argv[i].(string)
+	if !ok {
+		return "", ArgTypeError(name, "string", argv, i)
+	}
+	return s, nil
+}
+
+// Failed reports that the Go function behind a builtin returned an error.
+func Failed(name string, err error) error {
+	return &Error{Kind: "error", Msg: fmt.Sprintf("runtime error. '%v' failed: %v", name, err), Err: err}
+}
+
+// Guard wraps a builtin that calls into Go code so that a panic is
+// reported as the builtin failing, which scripts can catch.
+func Guard(name string, fn func([]interface{}) (interface{}, error)) func([]interface{}) (interface{}, error) {
+	return func(argv []interface{}) (val interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				perr, ok := r.(error)
+				if !ok {
+					perr = fmt.Errorf("%v", r)
+				}
+				val, err = nil, Failed(name, perr)
+			}
+		}()
+		return fn(argv)
+	}
+}
+
+// ArgTypeError reports that argument i of a builtin is not of the expected
+// type.
+func ArgTypeError(name string, expected string, argv []interface{}, i int) error {
+	return Errorf(TypeError, "runtime error. '%v' expects %v %v as argument %d but got %v", name, Article(expected), expected, i+1, TypeName(argv[i]))
+}
+
+// Article returns the indefinite article for a noun.
+func Article(noun string) string {
+	if strings.ContainsAny(noun[:1], "aeiou") {
+		return "an"
+	}
+	return "a"
+}
+
+// Arguments counts arguments, as in "1 argument" or "2 arguments".
+func Arguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+// TypeName describes the type of a value in DanLisp terms.
+func TypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case int64, *big.Int:
+		return "integer"
+	case *big.Rat:
+		return "rational"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case cons.ConsCell:
+		return "list"
+	case symbol.Symbol:
+		return "symbol"
+	case errorvalue.Error:
+		return "error"
+	case callable.Callable, func([]interface{}) (interface{}, error), func([]interface{}) interface{}:
+		return "function"
+	case callable.Macro:
+		return "macro"
+	}
+	// Builtins that need the interpreter, or that count the cells they
+	// allocate, have other signatures.
+	if reflect.ValueOf(v).Kind() == reflect.Func {
+		return "function"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -1,13 +1,14 @@
 package danreflect
 
-import "fmt"
-
-func getType(val interface{}) string {
-	return fmt.Sprintf("%T", val)
-}
+import (
+	"github.com/danwhitford/danlisp/internal/stdlib/builtin"
+)
 
 func Register(env map[string]interface{}) {
 	env["type"] = func(argv []interface{}) (interface{}, error) {
-		return getType(argv[0]), nil
+		if err := builtin.Arity("type", argv, 1); err != nil {
+			return nil, err
+		}
+		return builtin.TypeName(argv[0]), nil
 	}
 }
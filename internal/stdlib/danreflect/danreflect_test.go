@@ -0,0 +1,157 @@
+package danreflect
+
+import (
+	"errors"
+	"io"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danwhitford/danlisp/internal/stdlib/builtin"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+)
+
+func list(values ...interface{}) interface{} {
+	return cons.FromSlice(values)
+}
+
+func call(t *testing.T, fn interface{}, argv ...interface{}) (interface{}, error) {
+	t.Helper()
+	env := map[string]interface{}{}
+	if err := RegisterFunc(env, "f", fn); err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	return env["f"].(func([]interface{}) (interface{}, error))(argv)
+}
+
+func assertKind(t *testing.T, kind string, err error) {
+	t.Helper()
+	var berr *builtin.Error
+	if !errors.As(err, &berr) || berr.Kind != kind {
+		t.Fatalf("Expected a %v but got %v", kind, err)
+	}
+}
+
+func TestRegisterFuncConvertsArguments(t *testing.T) {
+	ret, err := call(t, func(a int, b uint8, c float32, s string, ok bool) string {
+		return strings.Repeat(s, a+int(b)) + reflect.ValueOf(c).String() + reflect.ValueOf(ok).String()
+	}, int64(1), int64(2), int64(3), "ab", true)
+	if err != nil {
+		t.Fatalf("Not expecting error but got %v", err)
+	}
+	if ret != "ababab<float32 Value><bool Value>" {
+		t.Fatalf("Unexpected result %v", ret)
+	}
+
+	ret, err = call(t, func(xs []float64, m map[string]int) float64 {
+		total := 0.0
+		for _, x := range xs {
+			total += x
+		}
+		return total + float64(m["a"])
+	}, list(int64(1), 0.5, big.NewRat(1, 2)), list(list("a", int64(10))))
+	if err != nil || ret != 12.0 {
+		t.Fatalf("Expected 12.0 but got %v, %v", ret, err)
+	}
+
+	ret, err = call(t, func(n *big.Int, x interface{}) []interface{} {
+		return []interface{}{n, x}
+	}, int64(5), nil)
+	if err != nil || ret.(cons.ConsCell).String() != "(5 nil)" {
+		t.Fatalf("Expected (5 nil) but got %v, %v", ret, err)
+	}
+}
+
+func TestRegisterFuncVariadic(t *testing.T) {
+	join := func(sep string, parts ...string) string {
+		return strings.Join(parts, sep)
+	}
+	ret, err := call(t, join, "-", "a", "b", "c")
+	if err != nil || ret != "a-b-c" {
+		t.Fatalf("Expected a-b-c but got %v, %v", ret, err)
+	}
+	ret, err = call(t, join, "-")
+	if err != nil || ret != "" {
+		t.Fatalf("Expected an empty string but got %v, %v", ret, err)
+	}
+	_, err = call(t, join)
+	assertKind(t, builtin.ArityError, err)
+	_, err = call(t, join, "-", "a", int64(1))
+	assertKind(t, builtin.TypeError, err)
+}
+
+func TestRegisterFuncResults(t *testing.T) {
+	ret, err := call(t, func() {})
+	if err != nil || ret != nil {
+		t.Fatalf("Expected nil but got %v, %v", ret, err)
+	}
+	ret, err = call(t, func() (int, string, error) { return 1, "a", nil })
+	if err != nil || ret.(cons.ConsCell).String() != `(1 "a")` {
+		t.Fatalf("Expected (1 \"a\") but got %v, %v", ret, err)
+	}
+	ret, err = call(t, func() (uint64, error) { return 1 << 63, nil })
+	if err != nil || ret.(*big.Int).String() != "9223372036854775808" {
+		t.Fatalf("Expected a big integer but got %v, %v", ret, err)
+	}
+
+	_, err = call(t, func() (int, error) { return 0, io.EOF })
+	assertKind(t, "error", err)
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("Expected the error to wrap io.EOF but got %v", err)
+	}
+	if err.Error() != "runtime error. 'f' failed: EOF" {
+		t.Fatalf("Unexpected message %v", err)
+	}
+}
+
+func TestRegisterFuncArgumentErrors(t *testing.T) {
+	sum := func(xs []int) int { return len(xs) }
+	sources := [][]interface{}{
+		{"a"},
+		{list(int64(1), "a")},
+		{int64(1)},
+	}
+	for _, argv := range sources {
+		_, err := call(t, sum, argv...)
+		assertKind(t, builtin.TypeError, err)
+	}
+	_, err := call(t, sum)
+	assertKind(t, builtin.ArityError, err)
+	if _, err = call(t, sum, "a"); err.Error() != "runtime error. 'f' expects a list of integers as argument 1 but got string" {
+		t.Fatalf("Unexpected message %v", err)
+	}
+
+	_, err = call(t, func(b int8) int8 { return b }, int64(300))
+	assertKind(t, builtin.ValueError, err)
+	_, err = call(t, func(b uint) uint { return b }, int64(-1))
+	assertKind(t, builtin.ValueError, err)
+	_, err = call(t, func(b [2]int) int { return b[0] }, list(int64(1)))
+	assertKind(t, builtin.ValueError, err)
+	_, err = call(t, func(m map[string]int) int { return len(m) }, list(list("a", "b")))
+	assertKind(t, builtin.TypeError, err)
+	if err.Error() != `runtime error. 'f' argument 1: value "b" is not an integer` {
+		t.Fatalf("Unexpected message %v", err)
+	}
+}
+
+func TestRegisterFuncRejectsUnsupported(t *testing.T) {
+	env := map[string]interface{}{}
+	if err := RegisterFunc(env, "f", 5); err == nil {
+		t.Fatal("Expected an error registering a number")
+	}
+	if err := RegisterFunc(env, "f", func(c chan int) {}); err == nil {
+		t.Fatal("Expected an error registering a function taking a channel")
+	}
+	if _, ok := env["f"]; ok {
+		t.Fatal("Expected nothing to be registered")
+	}
+}
+
+func TestRegisterFuncRecoversPanics(t *testing.T) {
+	_, err := call(t, func(n int) string { return strings.Repeat("x", n) }, int64(-1))
+	assertKind(t, "error", err)
+	if err.Error() != "runtime error. 'f' failed: strings: negative Repeat count" {
+		t.Fatalf("Unexpected message %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package danreflect
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/danwhitford/danlisp/internal/stdlib/builtin"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+)
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+	bigRatType = reflect.TypeOf((*big.Rat)(nil))
+)
+
+// RegisterFunc adds a Go function to env as a builtin, converting its
+// arguments and results as described by Wrap.
+func RegisterFunc(env map[string]interface{}, name string, fn interface{}) error {
+	wrapped, err := Wrap(name, fn)
+	if err != nil {
+		return err
+	}
+	env[name] = wrapped
+	return nil
+}
+
+// Wrap adapts any Go function to a builtin. Each argument is converted to
+// the type of its parameter: integers to int and uint types that can hold
+// them, any number to float types, lists to slices and arrays and
+// association lists to maps. Extra arguments to a variadic function are
+// converted to the type of its last parameter. A final error result becomes
+// a runtime error and the other results are converted with ToValue, with
+// several results returned as a list. A panic is raised as a runtime error
+// too.
+func Wrap(name string, fn interface{}) (func([]interface{}) (interface{}, error), error) {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func {
+		return nil, fmt.Errorf("cannot register %v: %T is not a function", name, fn)
+	}
+	ft := fv.Type()
+	for i := 0; i < ft.NumIn(); i++ {
+		if !supported(ft.In(i)) {
+			return nil, fmt.Errorf("cannot register %v: unsupported parameter type %v", name, ft.In(i))
+		}
+	}
+
+	fixed := ft.NumIn()
+	if ft.IsVariadic() {
+		fixed--
+	}
+	return builtin.Guard(name, func(argv []interface{}) (interface{}, error) {
+		if ft.IsVariadic() {
+			if err := builtin.MinArity(name, argv, fixed); err != nil {
+				return nil, err
+			}
+		} else if err := builtin.Arity(name, argv, fixed); err != nil {
+			return nil, err
+		}
+
+		in := make([]reflect.Value, len(argv))
+		for i := range argv {
+			var t reflect.Type
+			if i < fixed {
+				t = ft.In(i)
+			} else {
+				t = ft.In(fixed).Elem()
+			}
+			arg, ok, err := fromValue(argv[i], t)
+			if err != nil {
+				return nil, builtin.Errorf(err.(*builtin.Error).Kind, "runtime error. '%v' argument %d: %v", name, i+1, err)
+			}
+			if !ok {
+				return nil, builtin.ArgTypeError(name, describe(t), argv, i)
+			}
+			in[i] = arg
+		}
+		return results(name, fv.Call(in))
+	}), nil
+}
+
+func results(name string, out []reflect.Value) (interface{}, error) {
+	if n := len(out); n > 0 && out[n-1].Type() == errorType {
+		if err, _ := out[n-1].Interface().(error); err != nil {
+			return nil, builtin.Failed(name, err)
+		}
+		out = out[:n-1]
+	}
+	vals := make([]interface{}, len(out))
+	for i, v := range out {
+		val, err := ToValue(v.Interface())
+		if err != nil {
+			return nil, builtin.Errorf(builtin.TypeError, "runtime error. '%v' returned a value DanLisp can't use: %v", name, err)
+		}
+		vals[i] = val
+	}
+	switch len(vals) {
+	case 0:
+		return nil, nil
+	case 1:
+		return vals[0], nil
+	}
+	return cons.FromSlice(vals), nil
+}
+
+// supported reports whether fromValue can produce values of type t.
+func supported(t reflect.Type) bool {
+	if t == bigIntType || t == bigRatType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Interface,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice, reflect.Array:
+		return supported(t.Elem())
+	case reflect.Map:
+		return supported(t.Key()) && supported(t.Elem())
+	}
+	return false
+}
+
+// describe names the DanLisp values that convert to type t.
+func describe(t reflect.Type) string {
+	switch t {
+	case bigIntType:
+		return "integer"
+	case bigRatType:
+		return "rational"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		elem := describe(t.Elem())
+		if strings.HasPrefix(elem, "list") || strings.HasPrefix(elem, "association list") {
+			return "list of " + strings.Replace(elem, "list", "lists", 1)
+		}
+		return "list of " + elem + "s"
+	case reflect.Map:
+		return "association list"
+	}
+	return "value"
+}
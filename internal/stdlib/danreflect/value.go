@@ -0,0 +1,240 @@
+package danreflect
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+
+	"github.com/danwhitford/danlisp/internal/number"
+	"github.com/danwhitford/danlisp/internal/printer"
+	"github.com/danwhitford/danlisp/internal/stdlib/builtin"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/errorvalue"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/symbol"
+)
+
+// ToValue converts a Go value to a DanLisp value. Integers become int64, or
+// *big.Int if they are too large, and floats become float64. Slices and
+// arrays become lists and maps become association lists of (key value)
+// lists, sorted by key. Go functions are wrapped with Wrap. Builtins and
+// DanLisp values are passed through.
+func ToValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case func([]interface{}) (interface{}, error):
+		return v, nil
+	case *big.Int:
+		return number.Normalize(new(big.Int).Set(v)), nil
+	case *big.Rat:
+		return number.Normalize(new(big.Rat).Set(v)), nil
+	case symbol.Symbol, errorvalue.Error, cons.ConsCell:
+		return v, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u > math.MaxInt64 {
+			return new(big.Int).SetUint64(u), nil
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Slice, reflect.Array:
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			item, err := ToValue(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return cons.FromSlice(items), nil
+	case reflect.Map:
+		return mapToValue(rv)
+	case reflect.Func:
+		return Wrap("go function", v)
+	}
+	return nil, fmt.Errorf("cannot convert %T to a DanLisp value", v)
+}
+
+func mapToValue(rv reflect.Value) (interface{}, error) {
+	pairs := make([][]interface{}, 0, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, err := ToValue(iter.Key().Interface())
+		if err != nil {
+			return nil, err
+		}
+		val, err := ToValue(iter.Value().Interface())
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, []interface{}{key, val})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return printer.Repr(pairs[i][0]) < printer.Repr(pairs[j][0])
+	})
+	items := make([]interface{}, len(pairs))
+	for i, pair := range pairs {
+		items[i] = cons.FromSlice(pair)
+	}
+	return cons.FromSlice(items), nil
+}
+
+// fromValue converts a DanLisp value to the Go type t. It reports false if
+// the value is not of a kind that converts to t. A list whose elements
+// don't convert, or a number too large for t, is an error.
+func fromValue(v interface{}, t reflect.Type) (reflect.Value, bool, error) {
+	if t.Kind() == reflect.Interface {
+		if v == nil {
+			return reflect.Zero(t), true, nil
+		}
+		rv := reflect.ValueOf(v)
+		return rv, rv.Type().Implements(t), nil
+	}
+	switch t {
+	case reflect.TypeOf((*big.Int)(nil)):
+		if !number.IsInteger(v) {
+			return reflect.Value{}, false, nil
+		}
+		return reflect.ValueOf(new(big.Int).Set(number.ToBig(v))), true, nil
+	case reflect.TypeOf((*big.Rat)(nil)):
+		switch n := v.(type) {
+		case int64, *big.Int:
+			return reflect.ValueOf(new(big.Rat).SetInt(number.ToBig(n))), true, nil
+		case *big.Rat:
+			return reflect.ValueOf(new(big.Rat).Set(n)), true, nil
+		}
+		return reflect.Value{}, false, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := v.(bool)
+		return reflect.ValueOf(b).Convert(t), ok, nil
+	case reflect.String:
+		s, ok := v.(string)
+		return reflect.ValueOf(s).Convert(t), ok, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !number.IsInteger(v) {
+			return reflect.Value{}, false, nil
+		}
+		rv := reflect.New(t).Elem()
+		n, ok := v.(int64)
+		if !ok || rv.OverflowInt(n) {
+			return rv, true, builtin.Errorf(builtin.ValueError, "%v does not fit in %v", v, t)
+		}
+		rv.SetInt(n)
+		return rv, true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !number.IsInteger(v) {
+			return reflect.Value{}, false, nil
+		}
+		rv := reflect.New(t).Elem()
+		n := number.ToBig(v)
+		if !n.IsUint64() || rv.OverflowUint(n.Uint64()) {
+			return rv, true, builtin.Errorf(builtin.ValueError, "%v does not fit in %v", v, t)
+		}
+		rv.SetUint(n.Uint64())
+		return rv, true, nil
+	case reflect.Float32, reflect.Float64:
+		if !number.IsNumber(v) {
+			return reflect.Value{}, false, nil
+		}
+		return reflect.ValueOf(number.ToFloat(v)).Convert(t), true, nil
+	case reflect.Slice:
+		items, ok := listItems(v)
+		if !ok {
+			return reflect.Value{}, false, nil
+		}
+		rv := reflect.MakeSlice(t, len(items), len(items))
+		return rv, true, fillFrom(rv, items)
+	case reflect.Array:
+		items, ok := listItems(v)
+		if !ok {
+			return reflect.Value{}, false, nil
+		}
+		rv := reflect.New(t).Elem()
+		if len(items) != t.Len() {
+			return rv, true, builtin.Errorf(builtin.ValueError, "expected a list of %d elements but got %d", t.Len(), len(items))
+		}
+		return rv, true, fillFrom(rv, items)
+	case reflect.Map:
+		return mapFromValue(v, t)
+	}
+	return reflect.Value{}, false, nil
+}
+
+// fillFrom converts each item to the element type of the slice or array rv.
+func fillFrom(rv reflect.Value, items []interface{}) error {
+	for i, item := range items {
+		elem, ok, err := fromValue(item, rv.Type().Elem())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return mismatch(fmt.Sprintf("element %d", i+1), item, rv.Type().Elem())
+		}
+		rv.Index(i).Set(elem)
+	}
+	return nil
+}
+
+func mapFromValue(v interface{}, t reflect.Type) (reflect.Value, bool, error) {
+	items, ok := listItems(v)
+	if !ok {
+		return reflect.Value{}, false, nil
+	}
+	rv := reflect.MakeMapWithSize(t, len(items))
+	for _, item := range items {
+		pair, ok := listItems(item)
+		if !ok || len(pair) != 2 {
+			return rv, true, builtin.Errorf(builtin.TypeError, "expected (key value) but got %v", printer.Repr(item))
+		}
+		key, ok, err := fromValue(pair[0], t.Key())
+		if err != nil {
+			return rv, true, err
+		}
+		if !ok {
+			return rv, true, mismatch("key", pair[0], t.Key())
+		}
+		val, ok, err := fromValue(pair[1], t.Elem())
+		if err != nil {
+			return rv, true, err
+		}
+		if !ok {
+			return rv, true, mismatch("value", pair[1], t.Elem())
+		}
+		rv.SetMapIndex(key, val)
+	}
+	return rv, true, nil
+}
+
+func mismatch(what string, v interface{}, t reflect.Type) error {
+	expected := describe(t)
+	return builtin.Errorf(builtin.TypeError, "%v %v is not %v %v", what, printer.Repr(v), builtin.Article(expected), expected)
+}
+
+// listItems returns the elements of a proper list.
+func listItems(v interface{}) ([]interface{}, bool) {
+	items := []interface{}{}
+	for v != nil {
+		cell, ok := v.(cons.ConsCell)
+		if !ok {
+			return nil, false
+		}
+		items = append(items, cell.Car)
+		v = cell.Cdr
+	}
+	return items, true
+}
@@ -1,7 +1,9 @@
 package cons
 
 import (
-	"fmt"
+	"strings"
+
+	"github.com/danwhitford/danlisp/internal/printer"
 )
 
 type ConsCell struct {
@@ -13,38 +15,37 @@ func Cons(car interface{}, cdr interface{}) ConsCell {
 	return ConsCell{Car: car, Cdr: cdr}
 }
 
-func Register(env map[string]interface{}) {
-	env["cons"] = func(argv []interface{}) (interface{}, error) {
-		switch cdr := argv[1].(type) {
-		case interface{}:
-			return Cons(argv[0], cdr), nil
-		case nil:
-			return Cons(argv[0], nil), nil
+// String prints the cell in list notation, using a dot before a final cdr
+// that is not a list.
+func (cell ConsCell) String() string {
+	var b strings.Builder
+	b.WriteString("(")
+	b.WriteString(formatElem(cell.Car))
+	for rest := cell.Cdr; rest != nil; {
+		next, ok := rest.(ConsCell)
+		if !ok {
+			b.WriteString(" . ")
+			b.WriteString(formatElem(rest))
+			break
 		}
-		return nil, fmt.Errorf("could not cons, the value %v was not a ConsCell but a %T", argv[1], argv[1])
+		b.WriteString(" ")
+		b.WriteString(formatElem(next.Car))
+		rest = next.Cdr
 	}
+	b.WriteString(")")
+	return b.String()
+}
 
-	env["car"] = func(argv []interface{}) (interface{}, error) {
-		switch cons := argv[0].(type) {
-		case ConsCell:
-			return cons.Car, nil
-		case nil:
-			return nil, nil
-		}
-		return nil, fmt.Errorf("can only car a cons cell but not %v, which is %t", argv[0], argv[0])
-	}
+func formatElem(v interface{}) string {
+	return printer.Repr(v)
+}
 
-	env["cdr"] = func(argv []interface{}) (interface{}, error) {
-		switch cons := argv[0].(type) {
-		case ConsCell:
-			if cons.Cdr == nil {
-				return nil, nil
-			} else {
-				return cons.Cdr, nil
-			}
-		case nil:
-			return nil, nil
-		}
-		return nil, fmt.Errorf("can only cdr a cons cell but not %v, which is %t", argv[0], argv[0])
+// FromSlice builds a proper list from the values, returning nil for an empty
+// slice.
+func FromSlice(values []interface{}) interface{} {
+	var list interface{}
+	for i := len(values) - 1; i >= 0; i-- {
+		list = Cons(values[i], list)
 	}
+	return list
 }
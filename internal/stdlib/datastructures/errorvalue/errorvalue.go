@@ -0,0 +1,19 @@
+package errorvalue
+
+import (
+	"fmt"
+
+	"github.com/danwhitford/danlisp/internal/token"
+)
+
+// Error is a runtime error caught by a try, as seen by the script that
+// caught it.
+type Error struct {
+	Kind    string
+	Message string
+	Pos     token.Pos
+}
+
+func (err Error) String() string {
+	return fmt.Sprintf("#<error %v: %v>", err.Kind, err.Message)
+}
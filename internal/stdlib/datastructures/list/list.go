@@ -1,34 +1,75 @@
 package list
 
-import "github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+import (
+	"github.com/danwhitford/danlisp/internal/stdlib/builtin"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+)
 
 func Register(env map[string]interface{}) {
-	env["list"] = func(argv []interface{}) (interface{}, error) {
-		if len(argv) < 1 {
-			return nil, nil
+	env["cons"] = func(argv []interface{}) (interface{}, error) {
+		if err := builtin.Arity("cons", argv, 2); err != nil {
+			return nil, err
 		}
+		return cons.Cons(argv[0], argv[1]), nil
+	}
 
-		var val interface{}
-		var outer cons.ConsCell
-		for l := len(argv) - 1; l >= 0; l-- {
-			switch cdr := val.(type) {
-			case nil:
-				outer = cons.Cons(argv[l], nil)
-			case interface{}:
-				outer = cons.Cons(argv[l], cdr)
+	env["car"] = func(argv []interface{}) (interface{}, error) {
+		cell, err := listArg("car", argv)
+		if err != nil {
+			return nil, err
+		}
+		return cell.Car, nil
+	}
 
-			}
-			val = outer
+	env["cdr"] = func(argv []interface{}) (interface{}, error) {
+		cell, err := listArg("cdr", argv)
+		if err != nil {
+			return nil, err
 		}
-		return outer, nil
+		return cell.Cdr, nil
+	}
+
+	env["list"] = func(argv []interface{}) (interface{}, error) {
+		return cons.FromSlice(argv), nil
 	}
 
 	env["nth"] = func(argv []interface{}) (interface{}, error) {
-		hd := argv[0].(cons.ConsCell)
-		nth := argv[1].(float64)
-		for nth > 0 {
-			hd = hd.Cdr.(cons.ConsCell)
+		if err := builtin.Arity("nth", argv, 2); err != nil {
+			return nil, err
+		}
+		nth, err := builtin.Int("nth", argv, 1)
+		if err != nil {
+			return nil, err
 		}
-		return hd.Car, nil
+		if nth < 0 {
+			return nil, builtin.Errorf(builtin.ValueError, "runtime error. 'nth' index %d out of range", nth)
+		}
+		var hd interface{} = argv[0]
+		for ; nth >= 0; nth-- {
+			cell, ok := hd.(cons.ConsCell)
+			if !ok {
+				return nil, builtin.Errorf(builtin.ValueError, "runtime error. 'nth' index out of range")
+			}
+			if nth == 0 {
+				return cell.Car, nil
+			}
+			hd = cell.Cdr
+		}
+		return nil, nil
+	}
+}
+
+// listArg checks that a builtin was given a single list. The empty list
+// is returned as a cell whose car and cdr are nil.
+func listArg(name string, argv []interface{}) (cons.ConsCell, error) {
+	if err := builtin.Arity(name, argv, 1); err != nil {
+		return cons.ConsCell{}, err
+	}
+	switch cell := argv[0].(type) {
+	case cons.ConsCell:
+		return cell, nil
+	case nil:
+		return cons.ConsCell{}, nil
 	}
+	return cons.ConsCell{}, builtin.ArgTypeError(name, "list", argv, 0)
 }
@@ -0,0 +1,10 @@
+package symbol
+
+// Symbol is a symbol used as a value, such as one produced by quoting.
+type Symbol struct {
+	Name string
+}
+
+func (symbol Symbol) String() string {
+	return symbol.Name
+}
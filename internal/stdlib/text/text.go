@@ -0,0 +1,66 @@
+package text
+
+import (
+	"unicode/utf8"
+
+	"github.com/danwhitford/danlisp/internal/stdlib/builtin"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+)
+
+// Register adds builtins for working with strings. Lengths and indices
+// count characters rather than bytes.
+func Register(env map[string]interface{}) {
+	env["len"] = func(argv []interface{}) (interface{}, error) {
+		if err := builtin.Arity("len", argv, 1); err != nil {
+			return nil, err
+		}
+		switch v := argv[0].(type) {
+		case string:
+			return int64(utf8.RuneCountInString(v)), nil
+		case nil:
+			return int64(0), nil
+		case cons.ConsCell:
+			n := int64(0)
+			for l := interface{}(v); l != nil; n++ {
+				cell, ok := l.(cons.ConsCell)
+				if !ok {
+					return nil, builtin.Errorf(builtin.TypeError, "runtime error. 'len' expects a proper list")
+				}
+				l = cell.Cdr
+			}
+			return n, nil
+		}
+		return nil, builtin.Errorf(builtin.TypeError, "runtime error. 'len' expects a string or list as argument 1 but got %v", builtin.TypeName(argv[0]))
+	}
+
+	// (substr s start [end]) returns the characters from start up to but
+	// not including end, which defaults to the end of the string.
+	env["substr"] = func(argv []interface{}) (interface{}, error) {
+		if err := builtin.MinArity("substr", argv, 2); err != nil {
+			return nil, err
+		}
+		if len(argv) > 3 {
+			return nil, builtin.Errorf(builtin.ArityError, "runtime error. 'substr' expects 2 to 3 arguments but got %d", len(argv))
+		}
+		s, err := builtin.String("substr", argv, 0)
+		if err != nil {
+			return nil, err
+		}
+		chars := []rune(s)
+		start, err := builtin.Int("substr", argv, 1)
+		if err != nil {
+			return nil, err
+		}
+		end := len(chars)
+		if len(argv) == 3 {
+			end, err = builtin.Int("substr", argv, 2)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if start < 0 || end > len(chars) || start > end {
+			return nil, builtin.Errorf(builtin.ValueError, "runtime error. 'substr' range %d to %d is out of bounds for a string of length %d", start, end, len(chars))
+		}
+		return string(chars[start:end]), nil
+	}
+}
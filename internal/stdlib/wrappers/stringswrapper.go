@@ -1,15 +1,45 @@
-package stringswrapper
+// Code generated by wrappergen; DO NOT EDIT.
 
-import "strings"
+package wrappers
 
-func Register(env map[string]interface{}) {
+import (
+	"strings"
 
-	env["strings/Contains"] = func(argv []interface{}) (interface{}, error) {
-		return strings.Contains(argv[0].(string), argv[1].(string)), nil
-	}
+	"github.com/danwhitford/danlisp/internal/stdlib/danreflect"
+)
 
-	env["strings/Join"] = func(argv []interface{}) (interface{}, error) {
-		return strings.Join(argv[0].([]string), argv[1].(string)), nil
+// RegisterStrings adds the functions of package strings to env.
+func RegisterStrings(env map[string]interface{}) {
+	fns := map[string]interface{}{
+		"strings/Contains":     strings.Contains,
+		"strings/ContainsAny":  strings.ContainsAny,
+		"strings/ContainsRune": strings.ContainsRune,
+		"strings/Count":        strings.Count,
+		"strings/Cut":          strings.Cut,
+		"strings/EqualFold":    strings.EqualFold,
+		"strings/Fields":       strings.Fields,
+		"strings/HasPrefix":    strings.HasPrefix,
+		"strings/HasSuffix":    strings.HasSuffix,
+		"strings/Index":        strings.Index,
+		"strings/Join":         strings.Join,
+		"strings/LastIndex":    strings.LastIndex,
+		"strings/Repeat":       strings.Repeat,
+		"strings/Replace":      strings.Replace,
+		"strings/ReplaceAll":   strings.ReplaceAll,
+		"strings/Split":        strings.Split,
+		"strings/SplitN":       strings.SplitN,
+		"strings/ToLower":      strings.ToLower,
+		"strings/ToUpper":      strings.ToUpper,
+		"strings/Trim":         strings.Trim,
+		"strings/TrimLeft":     strings.TrimLeft,
+		"strings/TrimPrefix":   strings.TrimPrefix,
+		"strings/TrimRight":    strings.TrimRight,
+		"strings/TrimSpace":    strings.TrimSpace,
+		"strings/TrimSuffix":   strings.TrimSuffix,
+	}
+	for name, fn := range fns {
+		if err := danreflect.RegisterFunc(env, name, fn); err != nil {
+			panic(err)
+		}
 	}
-
 }
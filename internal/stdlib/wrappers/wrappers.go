@@ -0,0 +1,13 @@
+// Package wrappers holds builtins generated from Go packages by
+// cmd/wrappergen. Run go generate in this directory to regenerate them.
+//
+// The functions are listed explicitly so that the wrappers build with every
+// Go release the module supports.
+package wrappers
+
+//go:generate go run ../../../cmd/wrappergen -funcs Contains,ContainsAny,ContainsRune,Count,Cut,EqualFold,Fields,HasPrefix,HasSuffix,Index,Join,LastIndex,Repeat,Replace,ReplaceAll,Split,SplitN,ToLower,ToUpper,Trim,TrimLeft,TrimPrefix,TrimRight,TrimSpace,TrimSuffix strings
+
+// Register adds every generated wrapper to env.
+func Register(env map[string]interface{}) {
+	RegisterStrings(env)
+}
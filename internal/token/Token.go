@@ -1,5 +1,10 @@
 package token
 
+import (
+	"fmt"
+	"strings"
+)
+
 type TokenType int
 
 const (
@@ -12,11 +17,145 @@ const (
 	WHILE
 	DEFN
 	FOR
+	FN
+	QUOTE
+	QUASIQUOTE
+	UNQUOTE
+	UNQUOTE_SPLICING
+	TICK     // ' reader shorthand for quote
+	BACKTICK // ` reader shorthand for quasiquote
+	COMMA    // , reader shorthand for unquote
+	COMMA_AT // ,@ reader shorthand for unquote-splicing
+	DEFMACRO
+	LET
+	LETSTAR
+	COND
+	WHEN
+	UNLESS
+	DO
+	RETURN
+	BREAK
+	CONTINUE
+	TRY
+	THROW
+	AND
+	OR
 )
 
+// keywords maps the names of special forms to their token types. The parser
+// only treats them as special forms at the head of a list.
+var keywords = map[string]TokenType{
+	"set":              SET,
+	"if":               IF,
+	"while":            WHILE,
+	"defn":             DEFN,
+	"for":              FOR,
+	"fn":               FN,
+	"lambda":           FN,
+	"quote":            QUOTE,
+	"quasiquote":       QUASIQUOTE,
+	"unquote":          UNQUOTE,
+	"unquote-splicing": UNQUOTE_SPLICING,
+	"defmacro":         DEFMACRO,
+	"let":              LET,
+	"let*":             LETSTAR,
+	"cond":             COND,
+	"when":             WHEN,
+	"unless":           UNLESS,
+	"do":               DO,
+	"progn":            DO,
+	"return":           RETURN,
+	"break":            BREAK,
+	"continue":         CONTINUE,
+	"try":              TRY,
+	"throw":            THROW,
+	"and":              AND,
+	"or":               OR,
+}
+
+// Lookup returns the token type for a symbol, which is KEYWORD unless it
+// names a special form.
+func Lookup(lexeme string) TokenType {
+	if tt, ok := keywords[lexeme]; ok {
+		return tt
+	}
+	return KEYWORD
+}
+
 type Token struct {
 	TokenType TokenType
 	Lexeme    string
-	Line      int
+	Pos       Pos
 	Value     interface{}
 }
+
+// IsSymbol reports whether a token is a symbol. The names of special forms
+// are only special at the head of a list, so they count as symbols too.
+func (t Token) IsSymbol() bool {
+	return t.TokenType == KEYWORD || t.TokenType == Lookup(t.Lexeme)
+}
+
+// Pos is a location in a source file. Lines and columns start at 1, and
+// columns count characters rather than bytes.
+type Pos struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (pos Pos) IsValid() bool {
+	return pos.Line > 0
+}
+
+func (pos Pos) String() string {
+	if pos.File == "" {
+		return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", pos.File, pos.Line, pos.Column)
+}
+
+// Error is an error tied to a position in the source.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (err *Error) Error() string {
+	if !err.Pos.IsValid() {
+		return err.Msg
+	}
+	return fmt.Sprintf("%v: %v", err.Pos, err.Msg)
+}
+
+func (err *Error) Position() Pos {
+	return err.Pos
+}
+
+func Errorf(pos Pos, format string, a ...interface{}) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, a...)}
+}
+
+// Excerpt returns the source line containing pos with a caret underneath
+// the column, or an empty string if the line is not in source.
+func Excerpt(source string, pos Pos) string {
+	lines := strings.Split(source, "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return ""
+	}
+	line := strings.TrimRight(lines[pos.Line-1], "\r")
+	chars := []rune(line)
+	col := pos.Column
+	if col < 1 {
+		col = 1
+	}
+	var caret strings.Builder
+	for i := 0; i < col-1 && i < len(chars); i++ {
+		if chars[i] == '\t' {
+			caret.WriteByte('\t')
+		} else {
+			caret.WriteByte(' ')
+		}
+	}
+	caret.WriteByte('^')
+	return line + "\n" + caret.String()
+}
@@ -0,0 +1,28 @@
+package token
+
+import "testing"
+
+func TestExcerpt(t *testing.T) {
+	source := "(set x 1)\n\t(prn y)\n"
+	excerpt := Excerpt(source, Pos{Line: 2, Column: 7})
+	expected := "\t(prn y)\n\t     ^"
+	if excerpt != expected {
+		t.Fatalf("Assertion failed. Expected '%v' but got '%v'", expected, excerpt)
+	}
+}
+
+func TestErrorWithFile(t *testing.T) {
+	err := Errorf(Pos{File: "foo.dan", Line: 12, Column: 5}, "runtime error. %v", "oops")
+	if err.Error() != "foo.dan:12:5: runtime error. oops" {
+		t.Fatalf("Unexpected error message '%v'", err.Error())
+	}
+}
+
+func TestExcerptCountsCharacters(t *testing.T) {
+	source := "(prn \"héllo\" oops)"
+	excerpt := Excerpt(source, Pos{Line: 1, Column: 14})
+	expected := "(prn \"héllo\" oops)\n             ^"
+	if excerpt != expected {
+		t.Fatalf("Assertion failed. Expected '%v' but got '%v'", expected, excerpt)
+	}
+}
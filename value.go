@@ -0,0 +1,81 @@
+package danlisp
+
+import (
+	"github.com/danwhitford/danlisp/internal/callable"
+	"github.com/danwhitford/danlisp/internal/interpreter"
+	"github.com/danwhitford/danlisp/internal/stdlib/danreflect"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/cons"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/errorvalue"
+	"github.com/danwhitford/danlisp/internal/stdlib/datastructures/symbol"
+)
+
+// DanLisp values that have no Go equivalent. A Pair is a cons cell whose
+// cdr is not a list, which FromValue can't turn into a slice.
+type (
+	Symbol     = symbol.Symbol
+	ErrorValue = errorvalue.Error
+	Pair       = cons.ConsCell
+)
+
+// Builtin is the signature of a Go function that can be called from
+// DanLisp. It receives its arguments as DanLisp values.
+type Builtin = func(argv []interface{}) (interface{}, error)
+
+// Function is a DanLisp function or builtin returned to Go. It can be
+// passed back to DanLisp, for example with Define or as an argument to
+// Call.
+type Function struct {
+	fn interface{}
+}
+
+// ToValue converts a Go value to a DanLisp value.
+//
+//   - nil, bools and strings are unchanged.
+//   - Integers of any Go type become int64, or *big.Int if they are too
+//     large. Floats become float64.
+//   - *big.Int and *big.Rat are copied, and become int64 when they fit.
+//   - Slices and arrays become lists of their converted elements, with an
+//     empty slice becoming nil, the empty list.
+//   - Maps become association lists of (key value) lists, sorted by key.
+//   - Go functions become builtins that convert their arguments back to
+//     the parameter types. Integers convert to any integer type that can
+//     hold them, numbers to floats, lists to slices and association lists
+//     to maps. A final error result is raised as a runtime error.
+//   - Symbol, ErrorValue, Pair, Function and Builtin values are passed
+//     through.
+//
+// Any other type is an error.
+func ToValue(v interface{}) (interface{}, error) {
+	if fn, ok := v.(Function); ok {
+		return fn.fn, nil
+	}
+	return danreflect.ToValue(v)
+}
+
+// FromValue converts a DanLisp value to a Go value.
+//
+//   - nil, bools, strings, int64, *big.Int, *big.Rat and float64 are
+//     unchanged. nil is also the empty list.
+//   - Lists become []interface{} with their elements converted. A list
+//     that does not end in nil is left as a Pair.
+//   - Functions, builtins and macros become a Function.
+//   - Symbols and error values are unchanged.
+func FromValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case cons.ConsCell:
+		items := []interface{}{}
+		var list interface{} = v
+		for list != nil {
+			cell, ok := list.(cons.ConsCell)
+			if !ok {
+				return v
+			}
+			items = append(items, FromValue(cell.Car))
+			list = cell.Cdr
+		}
+		return items
+	case callable.Callable, callable.Macro, Builtin, func([]interface{}) interface{}, func(*interpreter.Interpreter, []interface{}) (interface{}, error):
+		return Function{fn: v}
+	}
+	return v
+}